@@ -0,0 +1,33 @@
+// Package example holds structs generated by gewh-gen, kept in sync by the golden test
+// of the generator and checked against core.StructCodec by round-trip tests.
+package example
+
+//go:generate go run .. report.go
+
+type Kelvin float32
+
+// single sensor reading of a station
+//
+//gewh:codec
+type Reading struct {
+	Sensor      uint8
+	Temperature float64 `gewh:"temp"`
+}
+
+// report sent by a weather station
+//
+//gewh:codec
+type Report struct {
+	Id       uint64 `gewh:"id"`
+	Station  string `gewh:"station,len=8"`
+	Offset   int32
+	Delta    int16
+	Healthy  bool
+	Ambient  Kelvin
+	Serial   []byte `gewh:"serial,len=4"`
+	Raw      []byte
+	Notes    string
+	Readings []Reading
+	Comment  string `gewh:"-"`
+	internal int
+}
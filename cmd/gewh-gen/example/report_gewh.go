@@ -0,0 +1,305 @@
+// Code generated by gewh-gen. DO NOT EDIT.
+
+package example
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+
+	"gewh/core"
+)
+
+var gewhSchemaReading = core.Schema{
+	{Name: "Sensor", Kind: "uint8"},
+	{Name: "temp", Kind: "float64"},
+}
+
+// wire layout of Reading
+func (*Reading) Schema() core.Schema {
+	return gewhSchemaReading
+}
+
+// transform Reading into byte fields
+func (v *Reading) ToFields() core.ByteFields {
+	return core.ByteFields{
+		{Name: "Sensor", DataType: reflect.TypeOf(v.Sensor), Value: &v.Sensor},
+		{Name: "temp", DataType: reflect.TypeOf(v.Temperature), Value: &v.Temperature},
+	}
+}
+
+// transform byte fields into Reading, every known field is applied and the first
+// unknown or mistyped one is reported
+func (v *Reading) FromFields(fields core.ByteFields) error {
+	var err error
+	for _, field := range fields {
+		var ok bool
+		switch field.Name {
+		case "Sensor":
+			v.Sensor, ok = core.FieldValue[uint8](field)
+		case "temp":
+			v.Temperature, ok = core.FieldValue[float64](field)
+		default:
+			if err == nil {
+				err = fmt.Errorf("%w: %s", core.ErrUnknownField, field.Name)
+			}
+			continue
+		}
+		if !ok && err == nil {
+			err = fmt.Errorf("%w: %T for field %s", core.ErrTypeMismatch, field.Value, field.Name)
+		}
+	}
+	return err
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (v *Reading) MarshalBinary() ([]byte, error) {
+	return v.AppendBinary(nil)
+}
+
+// AppendBinary appends the encoded Reading to dst
+func (v *Reading) AppendBinary(dst []byte) ([]byte, error) {
+	dst = append(dst, v.Sensor)
+	dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(v.Temperature))
+	return dst, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, the byte fields are copied out of data
+func (v *Reading) UnmarshalBinary(data []byte) error {
+	_, err := v.unmarshalBinary(data)
+	return err
+}
+
+// decode the start of data into v and return the unread bytes
+func (v *Reading) unmarshalBinary(data []byte) ([]byte, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("field Sensor: %w", core.ErrTruncated)
+	}
+	v.Sensor = data[0]
+	data = data[1:]
+	if len(data) < 8 {
+		return nil, fmt.Errorf("field temp: %w", core.ErrTruncated)
+	}
+	v.Temperature = math.Float64frombits(binary.LittleEndian.Uint64(data))
+	data = data[8:]
+	return data, nil
+}
+
+var gewhSchemaReport = core.Schema{
+	{Name: "id", Kind: "uint64"},
+	{Name: "station", Kind: "string", Len: 8},
+	{Name: "Offset", Kind: "int32"},
+	{Name: "Delta", Kind: "int16"},
+	{Name: "Healthy", Kind: "bool"},
+	{Name: "Ambient", Kind: "float32"},
+	{Name: "serial", Kind: "bytes", Len: 4},
+	{Name: "Raw", Kind: "bytes"},
+	{Name: "Notes", Kind: "string"},
+	{Name: "Readings", Kind: "list", Elem: gewhSchemaReading},
+}
+
+// wire layout of Report
+func (*Report) Schema() core.Schema {
+	return gewhSchemaReport
+}
+
+// transform Report into byte fields
+func (v *Report) ToFields() core.ByteFields {
+	readings := make([]core.ByteFields, len(v.Readings))
+	for i := range v.Readings {
+		readings[i] = v.Readings[i].ToFields()
+	}
+	return core.ByteFields{
+		{Name: "id", DataType: reflect.TypeOf(v.Id), Value: &v.Id},
+		{Name: "station", DataType: reflect.TypeOf(v.Station), Value: &v.Station},
+		{Name: "Offset", DataType: reflect.TypeOf(v.Offset), Value: &v.Offset},
+		{Name: "Delta", DataType: reflect.TypeOf(v.Delta), Value: &v.Delta},
+		{Name: "Healthy", DataType: reflect.TypeOf(v.Healthy), Value: &v.Healthy},
+		{Name: "Ambient", DataType: reflect.TypeOf(float32(v.Ambient)), Value: float32(v.Ambient)},
+		{Name: "serial", DataType: reflect.TypeOf(v.Serial), Value: &v.Serial},
+		{Name: "Raw", DataType: reflect.TypeOf(v.Raw), Value: &v.Raw},
+		{Name: "Notes", DataType: reflect.TypeOf(v.Notes), Value: &v.Notes},
+		{Name: "Readings", DataType: reflect.TypeOf(readings), Value: &readings},
+	}
+}
+
+// transform byte fields into Report, every known field is applied and the first
+// unknown or mistyped one is reported
+func (v *Report) FromFields(fields core.ByteFields) error {
+	var err error
+	for _, field := range fields {
+		var ok bool
+		switch field.Name {
+		case "id":
+			v.Id, ok = core.FieldValue[uint64](field)
+		case "station":
+			v.Station, ok = core.FieldValue[string](field)
+		case "Offset":
+			v.Offset, ok = core.FieldValue[int32](field)
+		case "Delta":
+			v.Delta, ok = core.FieldValue[int16](field)
+		case "Healthy":
+			v.Healthy, ok = core.FieldValue[bool](field)
+		case "Ambient":
+			var value float32
+			value, ok = core.FieldValue[float32](field)
+			v.Ambient = Kelvin(value)
+		case "serial":
+			v.Serial, ok = core.FieldValue[[]byte](field)
+		case "Raw":
+			v.Raw, ok = core.FieldValue[[]byte](field)
+		case "Notes":
+			v.Notes, ok = core.FieldValue[string](field)
+		case "Readings":
+			var list []core.ByteFields
+			list, ok = core.FieldValue[[]core.ByteFields](field)
+			v.Readings = make([]Reading, len(list))
+			for i := range list {
+				if elemErr := v.Readings[i].FromFields(list[i]); elemErr != nil && err == nil {
+					err = fmt.Errorf("field Readings element %d: %w", i, elemErr)
+				}
+			}
+		default:
+			if err == nil {
+				err = fmt.Errorf("%w: %s", core.ErrUnknownField, field.Name)
+			}
+			continue
+		}
+		if !ok && err == nil {
+			err = fmt.Errorf("%w: %T for field %s", core.ErrTypeMismatch, field.Value, field.Name)
+		}
+	}
+	return err
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (v *Report) MarshalBinary() ([]byte, error) {
+	return v.AppendBinary(nil)
+}
+
+// AppendBinary appends the encoded Report to dst
+func (v *Report) AppendBinary(dst []byte) ([]byte, error) {
+	dst = binary.LittleEndian.AppendUint64(dst, v.Id)
+	if len(v.Station) > 8 {
+		return dst, fmt.Errorf("field station: %w: %d bytes do not fit in a fixed length of 8", core.ErrLengthTooLarge, len(v.Station))
+	}
+	dst = append(dst, v.Station...)
+	dst = append(dst, make([]byte, 8-len(v.Station))...)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(v.Offset))
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(v.Delta))
+	if v.Healthy {
+		dst = append(dst, 1)
+	} else {
+		dst = append(dst, 0)
+	}
+	dst = binary.LittleEndian.AppendUint32(dst, math.Float32bits(float32(v.Ambient)))
+	if len(v.Serial) > 4 {
+		return dst, fmt.Errorf("field serial: %w: %d bytes do not fit in a fixed length of 4", core.ErrLengthTooLarge, len(v.Serial))
+	}
+	dst = append(dst, v.Serial...)
+	dst = append(dst, make([]byte, 4-len(v.Serial))...)
+	if uint64(len(v.Raw)) > math.MaxUint32 {
+		return dst, fmt.Errorf("field Raw does not fit in a uint32 length prefix")
+	}
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(v.Raw)))
+	dst = append(dst, v.Raw...)
+	if uint64(len(v.Notes)) > math.MaxUint32 {
+		return dst, fmt.Errorf("field Notes does not fit in a uint32 length prefix")
+	}
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(v.Notes)))
+	dst = append(dst, v.Notes...)
+	if uint64(len(v.Readings)) > math.MaxUint32 {
+		return dst, fmt.Errorf("field Readings does not fit in a uint32 length prefix")
+	}
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(v.Readings)))
+	for i := range v.Readings {
+		var err error
+		if dst, err = v.Readings[i].AppendBinary(dst); err != nil {
+			return dst, fmt.Errorf("field Readings element %d: %w", i, err)
+		}
+	}
+	return dst, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, the byte fields are copied out of data
+func (v *Report) UnmarshalBinary(data []byte) error {
+	_, err := v.unmarshalBinary(data)
+	return err
+}
+
+// decode the start of data into v and return the unread bytes
+func (v *Report) unmarshalBinary(data []byte) ([]byte, error) {
+	var n uint32
+	if len(data) < 8 {
+		return nil, fmt.Errorf("field id: %w", core.ErrTruncated)
+	}
+	v.Id = binary.LittleEndian.Uint64(data)
+	data = data[8:]
+	if len(data) < 8 {
+		return nil, fmt.Errorf("field station: %w", core.ErrTruncated)
+	}
+	v.Station = string(bytes.TrimRight(data[:8], "\x00"))
+	data = data[8:]
+	if len(data) < 4 {
+		return nil, fmt.Errorf("field Offset: %w", core.ErrTruncated)
+	}
+	v.Offset = int32(binary.LittleEndian.Uint32(data))
+	data = data[4:]
+	if len(data) < 2 {
+		return nil, fmt.Errorf("field Delta: %w", core.ErrTruncated)
+	}
+	v.Delta = int16(binary.LittleEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < 1 {
+		return nil, fmt.Errorf("field Healthy: %w", core.ErrTruncated)
+	}
+	v.Healthy = data[0] != 0
+	data = data[1:]
+	if len(data) < 4 {
+		return nil, fmt.Errorf("field Ambient: %w", core.ErrTruncated)
+	}
+	v.Ambient = Kelvin(math.Float32frombits(binary.LittleEndian.Uint32(data)))
+	data = data[4:]
+	if len(data) < 4 {
+		return nil, fmt.Errorf("field serial: %w", core.ErrTruncated)
+	}
+	v.Serial = make([]byte, 4)
+	copy(v.Serial, data)
+	data = data[4:]
+	if len(data) < 4 {
+		return nil, fmt.Errorf("field Raw: %w", core.ErrTruncated)
+	}
+	n, data = binary.LittleEndian.Uint32(data), data[4:]
+	if uint64(n) > uint64(len(data)) {
+		return nil, fmt.Errorf("field Raw: %w: length %d exceeds the %d bytes left", core.ErrTruncated, n, len(data))
+	}
+	v.Raw = make([]byte, n)
+	copy(v.Raw, data)
+	data = data[n:]
+	if len(data) < 4 {
+		return nil, fmt.Errorf("field Notes: %w", core.ErrTruncated)
+	}
+	n, data = binary.LittleEndian.Uint32(data), data[4:]
+	if uint64(n) > uint64(len(data)) {
+		return nil, fmt.Errorf("field Notes: %w: length %d exceeds the %d bytes left", core.ErrTruncated, n, len(data))
+	}
+	v.Notes = string(data[:n])
+	data = data[n:]
+	if len(data) < 4 {
+		return nil, fmt.Errorf("field Readings: %w", core.ErrTruncated)
+	}
+	n, data = binary.LittleEndian.Uint32(data), data[4:]
+	if uint64(n) > uint64(len(data)) {
+		return nil, fmt.Errorf("field Readings: %w: %d elements do not fit in %d bytes", core.ErrTruncated, n, len(data))
+	}
+	v.Readings = make([]Reading, n)
+	for i := range v.Readings {
+		var err error
+		if data, err = v.Readings[i].unmarshalBinary(data); err != nil {
+			return nil, fmt.Errorf("field Readings element %d: %w", i, err)
+		}
+	}
+	return data, nil
+}
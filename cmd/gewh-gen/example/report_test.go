@@ -0,0 +1,140 @@
+package example
+
+import (
+	"errors"
+	"gewh/core"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testReport() Report {
+	return Report{
+		Id:      7,
+		Station: "Athens",
+		Offset:  -3,
+		Delta:   -120,
+		Healthy: true,
+		Ambient: 293.5,
+		Serial:  []byte{0xCA, 0xFE, 0, 0},
+		Raw:     []byte("raw bytes"),
+		Notes:   "calibrated",
+		Readings: []Reading{
+			{Sensor: 1, Temperature: 21.5},
+			{Sensor: 2, Temperature: -4.25},
+		},
+	}
+}
+
+func TestGeneratedMatchesStructCodec(t *testing.T) {
+	codec, err := core.NewStructCodec[Report]()
+	require.NoError(t, err)
+	report := testReport()
+
+	t.Run("schema", func(t *testing.T) {
+		assert.Equal(t, codec.Schema(), report.Schema())
+	})
+
+	t.Run("generated bytes decode with the runtime codec", func(t *testing.T) {
+		encoded, err := report.MarshalBinary()
+		require.NoError(t, err)
+
+		s := core.NewSerialisable()
+		require.NoError(t, codec.Encode(s, report))
+		assert.Equal(t, s.GetBufString(), string(encoded), "generated and runtime encodings differ")
+
+		s.InsertDataToSerialisableBuffer(encoded)
+		decoded, err := codec.Decode(s)
+		require.NoError(t, err)
+		assert.Equal(t, report, decoded)
+	})
+
+	t.Run("runtime bytes decode with the generated codec", func(t *testing.T) {
+		s := core.NewSerialisable()
+		require.NoError(t, codec.Encode(s, report))
+
+		var decoded Report
+		require.NoError(t, decoded.UnmarshalBinary([]byte(s.GetBufString())))
+		assert.Equal(t, report, decoded)
+	})
+
+	t.Run("fields", func(t *testing.T) {
+		fromRuntime := Report{}
+		require.NoError(t, fromRuntime.FromFields(codec.ToFields(&report)))
+		assert.Equal(t, report, fromRuntime)
+
+		fromGenerated, err := codec.FromFields(report.ToFields())
+		require.NoError(t, err)
+		assert.Equal(t, report, fromGenerated)
+	})
+
+	t.Run("through a serialisable", func(t *testing.T) {
+		s := core.NewSerialisable(core.WithFraming())
+		s.Codec.AddSchema(report.Schema())
+		s.Codec.AddFields(report.ToFields())
+		require.NoError(t, s.Encode())
+
+		fields, err := s.Decode()
+		require.NoError(t, err)
+		decoded := Report{}
+		require.NoError(t, decoded.FromFields(fields))
+		assert.Equal(t, report, decoded)
+	})
+}
+
+func TestGeneratedErrors(t *testing.T) {
+	report := testReport()
+	encoded, err := report.MarshalBinary()
+	require.NoError(t, err)
+	for n := 0; n < len(encoded); n++ {
+		err := new(Report).UnmarshalBinary(encoded[:n])
+		assert.True(t, errors.Is(err, core.ErrTruncated), "%d bytes: expected ErrTruncated, got %v", n, err)
+	}
+
+	report.Station = "Thessaloniki"
+	_, err = report.MarshalBinary()
+	assert.ErrorIs(t, err, core.ErrLengthTooLarge)
+
+	version := uint16(1)
+	err = new(Report).FromFields(core.ByteFields{{Name: "Version", Value: &version}})
+	assert.ErrorIs(t, err, core.ErrUnknownField)
+	err = new(Report).FromFields(core.ByteFields{{Name: "id", Value: &version}})
+	assert.ErrorIs(t, err, core.ErrTypeMismatch)
+}
+
+func BenchmarkReport(b *testing.B) {
+	codec, err := core.NewStructCodec[Report]()
+	require.NoError(b, err)
+	report := testReport()
+	encoded, _ := report.MarshalBinary()
+
+	b.Run("generated encode", func(b *testing.B) {
+		b.ReportAllocs()
+		buf := make([]byte, 0, len(encoded))
+		for i := 0; i < b.N; i++ {
+			buf, _ = report.AppendBinary(buf[:0])
+		}
+	})
+	b.Run("struct codec encode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			codec.Encode(core.NewSerialisable(), report)
+		}
+	})
+	b.Run("generated decode", func(b *testing.B) {
+		b.ReportAllocs()
+		var decoded Report
+		for i := 0; i < b.N; i++ {
+			decoded.UnmarshalBinary(encoded)
+		}
+	})
+	b.Run("struct codec decode", func(b *testing.B) {
+		b.ReportAllocs()
+		s := core.NewSerialisable()
+		s.InsertDataToSerialisableBuffer(encoded)
+		for i := 0; i < b.N; i++ {
+			codec.Decode(s)
+		}
+	})
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gewh/core"
+)
+
+// comment line marking a struct for generation
+const annotation = "//gewh:codec"
+
+// size and little-endian append/read expressions of the fixed size kinds, %s is the value
+var fixedKinds = map[core.FieldKind]struct {
+	size   int
+	append string
+	read   string
+}{
+	core.KindUint8:   {1, "append(dst, %s)", "data[0]"},
+	core.KindInt8:    {1, "append(dst, uint8(%s))", "int8(data[0])"},
+	core.KindUint16:  {2, "binary.LittleEndian.AppendUint16(dst, %s)", "binary.LittleEndian.Uint16(data)"},
+	core.KindInt16:   {2, "binary.LittleEndian.AppendUint16(dst, uint16(%s))", "int16(binary.LittleEndian.Uint16(data))"},
+	core.KindUint32:  {4, "binary.LittleEndian.AppendUint32(dst, %s)", "binary.LittleEndian.Uint32(data)"},
+	core.KindInt32:   {4, "binary.LittleEndian.AppendUint32(dst, uint32(%s))", "int32(binary.LittleEndian.Uint32(data))"},
+	core.KindUint64:  {8, "binary.LittleEndian.AppendUint64(dst, %s)", "binary.LittleEndian.Uint64(data)"},
+	core.KindInt64:   {8, "binary.LittleEndian.AppendUint64(dst, uint64(%s))", "int64(binary.LittleEndian.Uint64(data))"},
+	core.KindFloat32: {4, "binary.LittleEndian.AppendUint32(dst, math.Float32bits(%s))", "math.Float32frombits(binary.LittleEndian.Uint32(data))"},
+	core.KindFloat64: {8, "binary.LittleEndian.AppendUint64(dst, math.Float64bits(%s))", "math.Float64frombits(binary.LittleEndian.Uint64(data))"},
+	core.KindBool:    {1, "", "data[0] != 0"}, // appended by writeAppend
+}
+
+// go types with a wire kind
+var basicTypes = map[string]core.FieldKind{
+	"uint8":   core.KindUint8,
+	"byte":    core.KindUint8,
+	"uint16":  core.KindUint16,
+	"uint32":  core.KindUint32,
+	"uint64":  core.KindUint64,
+	"int8":    core.KindInt8,
+	"int16":   core.KindInt16,
+	"int32":   core.KindInt32,
+	"int64":   core.KindInt64,
+	"float32": core.KindFloat32,
+	"float64": core.KindFloat64,
+	"bool":    core.KindBool,
+	"string":  core.KindString,
+	"[]byte":  core.KindBytes,
+	"[]uint8": core.KindBytes,
+}
+
+// a struct to generate methods for
+type genStruct struct {
+	name   string
+	fields []genField
+}
+
+type genField struct {
+	name   string         // go field name
+	spec   core.FieldSpec // wire layout
+	goType string         // type as declared
+	base   string         // basic type goType is converted to on the wire
+	elem   string         // element struct of a list
+}
+
+// the parsed package files
+type generator struct {
+	pkg      string
+	types    map[string]ast.Expr // type declarations by name
+	structs  []*genStruct        // annotated structs in source order
+	corePath string              // import path of the core package
+}
+
+// parse the files of a package and collect the annotated structs
+func parseFiles(coreImport string, filenames ...string) (*generator, error) {
+	g := &generator{types: make(map[string]ast.Expr), corePath: coreImport}
+	fset := token.NewFileSet()
+	var annotated []*ast.TypeSpec
+	for _, filename := range filenames {
+		file, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if g.pkg != "" && g.pkg != file.Name.Name {
+			return nil, fmt.Errorf("%s: package %s, expected %s", filename, file.Name.Name, g.pkg)
+		}
+		g.pkg = file.Name.Name
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				g.types[ts.Name.Name] = ts.Type
+				if isAnnotated(ts.Doc) || (len(gen.Specs) == 1 && isAnnotated(gen.Doc)) {
+					annotated = append(annotated, ts)
+				}
+			}
+		}
+	}
+	for _, ts := range annotated {
+		s, err := g.newStruct(ts)
+		if err != nil {
+			return nil, err
+		}
+		g.structs = append(g.structs, s)
+	}
+	return g, nil
+}
+
+func isAnnotated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, comment := range doc.List {
+		if strings.TrimSpace(comment.Text) == annotation {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) newStruct(ts *ast.TypeSpec) (*genStruct, error) {
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return nil, fmt.Errorf("%s: only structs can be annotated", ts.Name.Name)
+	}
+	s := &genStruct{name: ts.Name.Name}
+	for _, field := range st.Fields.List {
+		for _, name := range field.Names {
+			if !name.IsExported() {
+				continue
+			}
+			f, skip, err := g.newField(name.Name, field)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", s.name, name.Name, err)
+			}
+			if !skip {
+				s.fields = append(s.fields, f)
+			}
+		}
+	}
+	return s, nil
+}
+
+func (g *generator) newField(name string, field *ast.Field) (genField, bool, error) {
+	f := genField{name: name, goType: exprString(field.Type)}
+	wireName, length, err := parseTag(name, field.Tag)
+	if err != nil || wireName == "-" {
+		return f, true, err
+	}
+	f.spec = core.FieldSpec{Name: wireName, Len: length}
+
+	if slice, ok := field.Type.(*ast.ArrayType); ok && slice.Len == nil {
+		if elem, ok := slice.Elt.(*ast.Ident); ok {
+			if _, ok := g.types[elem.Name].(*ast.StructType); ok {
+				f.spec.Kind = core.KindList
+				f.elem = elem.Name
+			}
+		}
+	}
+	if f.elem == "" {
+		if f.base, f.spec.Kind, err = g.resolve(field.Type); err != nil {
+			return f, false, err
+		}
+	}
+	if length > 0 && f.spec.Kind != core.KindString && f.spec.Kind != core.KindBytes {
+		return f, false, fmt.Errorf("len only applies to strings and byte slices")
+	}
+	return f, false, nil
+}
+
+// find the basic type and wire kind of a type expression, following declarations in the package
+func (g *generator) resolve(expr ast.Expr) (string, core.FieldKind, error) {
+	for seen := 0; seen < len(g.types)+1; seen++ {
+		typ := exprString(expr)
+		if kind, ok := basicTypes[typ]; ok {
+			if kind == core.KindBytes {
+				typ = "[]byte"
+			}
+			return typ, kind, nil
+		}
+		ident, ok := expr.(*ast.Ident)
+		if !ok || g.types[ident.Name] == nil {
+			break
+		}
+		expr = g.types[ident.Name]
+	}
+	return "", "", fmt.Errorf("unsupported type %s", exprString(expr))
+}
+
+// parse `gewh:"name,len=N"` the same way core.StructCodec does
+func parseTag(name string, lit *ast.BasicLit) (string, int, error) {
+	var tag string
+	if lit != nil {
+		raw, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return "", 0, err
+		}
+		tag = reflect.StructTag(raw).Get("gewh")
+	}
+	wireName, opts, _ := strings.Cut(tag, ",")
+	if wireName == "" {
+		wireName = name
+	}
+	length := 0
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == "" {
+			continue
+		}
+		value, ok := strings.CutPrefix(opt, "len=")
+		if !ok {
+			return "", 0, fmt.Errorf("unknown tag option %q", opt)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return "", 0, fmt.Errorf("invalid length %q", value)
+		}
+		length = n
+	}
+	return wireName, length, nil
+}
+
+func exprString(expr ast.Expr) string {
+	var buf bytes.Buffer
+	format.Node(&buf, token.NewFileSet(), expr)
+	return buf.String()
+}
+
+// write the generated methods for every annotated struct, gofmt'ed
+func (g *generator) generate() ([]byte, error) {
+	if len(g.structs) == 0 {
+		return nil, fmt.Errorf("no structs annotated with %s", annotation)
+	}
+	for _, s := range g.structs {
+		for _, f := range s.fields {
+			if f.elem != "" && !g.isGenerated(f.elem) {
+				return nil, fmt.Errorf("%s.%s: element type %s must be annotated with %s", s.name, f.name, f.elem, annotation)
+			}
+		}
+	}
+
+	var body bytes.Buffer
+	for _, s := range g.structs {
+		g.writeStruct(&body, s)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by gewh-gen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", g.pkg)
+	for _, pkg := range []string{"bytes", "encoding/binary", "fmt", "math", "reflect"} {
+		if bytes.Contains(body.Bytes(), []byte(pkg[strings.LastIndex(pkg, "/")+1:]+".")) {
+			fmt.Fprintf(&out, "%q\n", pkg)
+		}
+	}
+	fmt.Fprintf(&out, "\n%q\n)\n", g.corePath)
+	out.Write(body.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+	return src, nil
+}
+
+func (g *generator) isGenerated(name string) bool {
+	for _, s := range g.structs {
+		if s.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isVariable(f genField) bool {
+	return f.spec.Kind == core.KindString || f.spec.Kind == core.KindBytes || f.spec.Kind == core.KindList
+}
+
+// value of the field as its basic type
+func (f genField) value() string {
+	if f.base != f.goType {
+		return fmt.Sprintf("%s(v.%s)", f.base, f.name)
+	}
+	return "v." + f.name
+}
+
+// convert an expression of the basic type back to the declared type
+func (f genField) declared(expr string) string {
+	if f.base != f.goType {
+		return fmt.Sprintf("%s(%s)", f.goType, expr)
+	}
+	return expr
+}
+
+func (g *generator) writeStruct(w *bytes.Buffer, s *genStruct) {
+	// schema
+	fmt.Fprintf(w, "\nvar gewhSchema%s = core.Schema{\n", s.name)
+	for _, f := range s.fields {
+		g.writeSpec(w, f)
+	}
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "\n// wire layout of %s\nfunc (*%s) Schema() core.Schema {\nreturn gewhSchema%s\n}\n", s.name, s.name, s.name)
+
+	// ToFields
+	fmt.Fprintf(w, "\n// transform %s into byte fields\nfunc (v *%s) ToFields() core.ByteFields {\n", s.name, s.name)
+	for _, f := range s.fields {
+		if f.elem != "" {
+			fmt.Fprintf(w, "%s := make([]core.ByteFields, len(v.%s))\nfor i := range v.%s {\n%s[i] = v.%s[i].ToFields()\n}\n",
+				local(f), f.name, f.name, local(f), f.name)
+		}
+	}
+	fmt.Fprintf(w, "return core.ByteFields{\n")
+	for _, f := range s.fields {
+		switch {
+		case f.elem != "":
+			fmt.Fprintf(w, "{Name: %q, DataType: reflect.TypeOf(%s), Value: &%s},\n", f.spec.Name, local(f), local(f))
+		case f.base != f.goType:
+			fmt.Fprintf(w, "{Name: %q, DataType: reflect.TypeOf(%s), Value: %s},\n", f.spec.Name, f.value(), f.value())
+		default:
+			fmt.Fprintf(w, "{Name: %q, DataType: reflect.TypeOf(v.%s), Value: &v.%s},\n", f.spec.Name, f.name, f.name)
+		}
+	}
+	fmt.Fprintf(w, "}\n}\n")
+
+	// FromFields
+	fmt.Fprintf(w, "\n// transform byte fields into %s, every known field is applied and the first\n// unknown or mistyped one is reported\n", s.name)
+	fmt.Fprintf(w, "func (v *%s) FromFields(fields core.ByteFields) error {\nvar err error\nfor _, field := range fields {\nvar ok bool\nswitch field.Name {\n", s.name)
+	for _, f := range s.fields {
+		fmt.Fprintf(w, "case %q:\n", f.spec.Name)
+		switch {
+		case f.elem != "":
+			fmt.Fprintf(w, "var list []core.ByteFields\nlist, ok = core.FieldValue[[]core.ByteFields](field)\nv.%s = make([]%s, len(list))\n", f.name, f.elem)
+			fmt.Fprintf(w, "for i := range list {\nif elemErr := v.%s[i].FromFields(list[i]); elemErr != nil && err == nil {\nerr = fmt.Errorf(\"field %s element %%d: %%w\", i, elemErr)\n}\n}\n", f.name, f.spec.Name)
+		case f.base != f.goType:
+			fmt.Fprintf(w, "var value %s\nvalue, ok = core.FieldValue[%s](field)\nv.%s = %s\n", f.base, f.base, f.name, f.declared("value"))
+		default:
+			fmt.Fprintf(w, "v.%s, ok = core.FieldValue[%s](field)\n", f.name, f.base)
+		}
+	}
+	fmt.Fprintf(w, "default:\nif err == nil {\nerr = fmt.Errorf(\"%%w: %%s\", core.ErrUnknownField, field.Name)\n}\ncontinue\n}\n")
+	fmt.Fprintf(w, "if !ok && err == nil {\nerr = fmt.Errorf(\"%%w: %%T for field %%s\", core.ErrTypeMismatch, field.Value, field.Name)\n}\n}\nreturn err\n}\n")
+
+	// MarshalBinary and AppendBinary
+	fmt.Fprintf(w, "\n// MarshalBinary implements encoding.BinaryMarshaler\nfunc (v *%s) MarshalBinary() ([]byte, error) {\nreturn v.AppendBinary(nil)\n}\n", s.name)
+	fmt.Fprintf(w, "\n// AppendBinary appends the encoded %s to dst\nfunc (v *%s) AppendBinary(dst []byte) ([]byte, error) {\n", s.name, s.name)
+	for _, f := range s.fields {
+		g.writeAppend(w, f)
+	}
+	fmt.Fprintf(w, "return dst, nil\n}\n")
+
+	// UnmarshalBinary
+	fmt.Fprintf(w, "\n// UnmarshalBinary implements encoding.BinaryUnmarshaler, the byte fields are copied out of data\nfunc (v *%s) UnmarshalBinary(data []byte) error {\n_, err := v.unmarshalBinary(data)\nreturn err\n}\n", s.name)
+	fmt.Fprintf(w, "\n// decode the start of data into v and return the unread bytes\nfunc (v *%s) unmarshalBinary(data []byte) ([]byte, error) {\n", s.name)
+	needsLength := false
+	for _, f := range s.fields {
+		needsLength = needsLength || isVariable(f) && f.spec.Len == 0
+	}
+	if needsLength {
+		fmt.Fprintf(w, "var n uint32\n")
+	}
+	for _, f := range s.fields {
+		g.writeRead(w, f)
+	}
+	fmt.Fprintf(w, "return data, nil\n}\n")
+}
+
+func (g *generator) writeSpec(w *bytes.Buffer, f genField) {
+	fmt.Fprintf(w, "{Name: %q, Kind: %q", f.spec.Name, f.spec.Kind)
+	if f.elem != "" {
+		fmt.Fprintf(w, ", Elem: gewhSchema%s", f.elem)
+	}
+	if f.spec.Len > 0 {
+		fmt.Fprintf(w, ", Len: %d", f.spec.Len)
+	}
+	fmt.Fprintf(w, "},\n")
+}
+
+// name of the local holding the list of a field in ToFields
+func local(f genField) string {
+	return strings.ToLower(f.name[:1]) + f.name[1:]
+}
+
+func (g *generator) writeAppend(w *bytes.Buffer, f genField) {
+	if f.spec.Kind == core.KindBool {
+		// inline, a helper function would be declared again by every generated file of the package
+		fmt.Fprintf(w, "if %s {\ndst = append(dst, 1)\n} else {\ndst = append(dst, 0)\n}\n", f.value())
+		return
+	}
+	if fixed, ok := fixedKinds[f.spec.Kind]; ok {
+		fmt.Fprintf(w, "dst = "+fixed.append+"\n", f.value())
+		return
+	}
+	value := f.value()
+	if f.spec.Len > 0 {
+		fmt.Fprintf(w, "if len(%s) > %d {\nreturn dst, fmt.Errorf(\"field %s: %%w: %%d bytes do not fit in a fixed length of %d\", core.ErrLengthTooLarge, len(%s))\n}\n",
+			value, f.spec.Len, f.spec.Name, f.spec.Len, value)
+		fmt.Fprintf(w, "dst = append(dst, %s...)\ndst = append(dst, make([]byte, %d-len(%s))...)\n", value, f.spec.Len, value)
+		return
+	}
+	fmt.Fprintf(w, "if uint64(len(v.%s)) > math.MaxUint32 {\nreturn dst, fmt.Errorf(\"field %s does not fit in a uint32 length prefix\")\n}\n", f.name, f.spec.Name)
+	fmt.Fprintf(w, "dst = binary.LittleEndian.AppendUint32(dst, uint32(len(v.%s)))\n", f.name)
+	if f.elem != "" {
+		fmt.Fprintf(w, "for i := range v.%s {\nvar err error\nif dst, err = v.%s[i].AppendBinary(dst); err != nil {\nreturn dst, fmt.Errorf(\"field %s element %%d: %%w\", i, err)\n}\n}\n", f.name, f.name, f.spec.Name)
+		return
+	}
+	fmt.Fprintf(w, "dst = append(dst, %s...)\n", value)
+}
+
+func (g *generator) writeRead(w *bytes.Buffer, f genField) {
+	truncated := func(size string) {
+		fmt.Fprintf(w, "if len(data) < %s {\nreturn nil, fmt.Errorf(\"field %s: %%w\", core.ErrTruncated)\n}\n", size, f.spec.Name)
+	}
+	if fixed, ok := fixedKinds[f.spec.Kind]; ok {
+		truncated(strconv.Itoa(fixed.size))
+		fmt.Fprintf(w, "v.%s = %s\ndata = data[%d:]\n", f.name, f.declared(fixed.read), fixed.size)
+		return
+	}
+	length := "n"
+	if f.spec.Len > 0 {
+		length = strconv.Itoa(f.spec.Len)
+	} else {
+		truncated("4")
+		fmt.Fprintf(w, "n, data = binary.LittleEndian.Uint32(data), data[4:]\n")
+	}
+	if f.elem != "" {
+		// every element takes at least one byte
+		fmt.Fprintf(w, "if uint64(n) > uint64(len(data)) {\nreturn nil, fmt.Errorf(\"field %s: %%w: %%d elements do not fit in %%d bytes\", core.ErrTruncated, n, len(data))\n}\n", f.spec.Name)
+		fmt.Fprintf(w, "v.%s = make([]%s, n)\nfor i := range v.%s {\nvar err error\nif data, err = v.%s[i].unmarshalBinary(data); err != nil {\nreturn nil, fmt.Errorf(\"field %s element %%d: %%w\", i, err)\n}\n}\n",
+			f.name, f.elem, f.name, f.name, f.spec.Name)
+		return
+	}
+	if f.spec.Len > 0 {
+		truncated(length)
+	} else {
+		fmt.Fprintf(w, "if uint64(n) > uint64(len(data)) {\nreturn nil, fmt.Errorf(\"field %s: %%w: length %%d exceeds the %%d bytes left\", core.ErrTruncated, n, len(data))\n}\n", f.spec.Name)
+	}
+	switch {
+	case f.spec.Kind == core.KindString && f.spec.Len > 0:
+		fmt.Fprintf(w, "v.%s = %s\n", f.name, f.declared(fmt.Sprintf("string(bytes.TrimRight(data[:%s], \"\\x00\"))", length)))
+	case f.spec.Kind == core.KindString:
+		fmt.Fprintf(w, "v.%s = %s\n", f.name, f.declared(fmt.Sprintf("string(data[:%s])", length)))
+	default:
+		fmt.Fprintf(w, "v.%s = %s\ncopy(v.%s, data)\n", f.name, f.declared(fmt.Sprintf("make([]byte, %s)", length)), f.name)
+	}
+	fmt.Fprintf(w, "data = data[%s:]\n", length)
+}
@@ -0,0 +1,58 @@
+// Command gewh-gen writes reflection-free codec methods for structs annotated with
+// //gewh:codec. For every annotated struct it generates Schema, ToFields, FromFields,
+// MarshalBinary, AppendBinary and UnmarshalBinary using the same wire format and
+// `gewh:"name,len=N"` tags as core.StructCodec. Use it from go generate:
+//
+//	//go:generate go run gewh/cmd/gewh-gen
+//
+// which reads $GOFILE and writes the methods to a _gewh.go file next to it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	output := flag.String("output", "", "output file, defaults to <input>_gewh.go for a single input")
+	coreImport := flag.String("core", "gewh/core", "import path of the core package")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: gewh-gen [flags] [file.go ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("gewh-gen: ")
+
+	files := flag.Args()
+	if len(files) == 0 {
+		gofile := os.Getenv("GOFILE")
+		if gofile == "" {
+			flag.Usage()
+			os.Exit(2)
+		}
+		files = []string{gofile}
+	}
+	if *output == "" {
+		if len(files) > 1 {
+			log.Fatal("-output is required with more than one input file")
+		}
+		*output = strings.TrimSuffix(files[0], ".go") + "_gewh.go"
+	}
+
+	g, err := parseFiles(*coreImport, files...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := g.generate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Clean(*output), src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
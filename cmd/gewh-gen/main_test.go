@@ -0,0 +1,101 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the checked in example must match what the generator writes today, run
+// go generate ./cmd/gewh-gen/example after changing the generator
+func TestGolden(t *testing.T) {
+	g, err := parseFiles("gewh/core", filepath.Join("example", "report.go"))
+	require.NoError(t, err)
+	got, err := g.generate()
+	require.NoError(t, err)
+
+	want, err := os.ReadFile(filepath.Join("example", "report_gewh.go"))
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"no annotated structs", "type A struct{ Id uint16 }"},
+		{"unsupported type", "//gewh:codec\ntype A struct{ Id int }"},
+		{"nested struct", "type B struct{ Id uint16 }\n//gewh:codec\ntype A struct{ B B }"},
+		{"unannotated element", "type B struct{ Id uint16 }\n//gewh:codec\ntype A struct{ Bs []B }"},
+		{"len on a number", "//gewh:codec\ntype A struct{ Id uint16 `gewh:\"id,len=2\"` }"},
+		{"unknown option", "//gewh:codec\ntype A struct{ Name string `gewh:\"name,size=2\"` }"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "a.go")
+			require.NoError(t, os.WriteFile(filename, []byte("package a\n\n"+tt.src+"\n"), 0644))
+			g, err := parseFiles("gewh/core", filename)
+			if err == nil {
+				_, err = g.generate()
+			}
+			assert.Error(t, err)
+		})
+	}
+}
+
+// files generated one per input, as with a go:generate directive per file, must not
+// declare the same package level names
+func TestGenerateFilesOfOnePackage(t *testing.T) {
+	dir := t.TempDir()
+	inputs := map[string]string{
+		"a.go": "//gewh:codec\ntype A struct{ Ok bool }",
+		"b.go": "//gewh:codec\ntype B struct{ Ok bool }",
+	}
+	declared := make(map[string]string)
+	for name, src := range inputs {
+		filename := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(filename, []byte("package a\n\n"+src+"\n"), 0644))
+		g, err := parseFiles("gewh/core", filename)
+		require.NoError(t, err)
+		out, err := g.generate()
+		require.NoError(t, err)
+
+		for _, src := range [][]byte{[]byte("package a\n\n" + src + "\n"), out} {
+			file, err := parser.ParseFile(token.NewFileSet(), name, src, 0)
+			require.NoError(t, err)
+			for _, decl := range file.Decls {
+				var names []string
+				switch decl := decl.(type) {
+				case *ast.FuncDecl:
+					if decl.Recv == nil {
+						names = append(names, decl.Name.Name)
+					}
+				case *ast.GenDecl:
+					for _, spec := range decl.Specs {
+						switch spec := spec.(type) {
+						case *ast.TypeSpec:
+							names = append(names, spec.Name.Name)
+						case *ast.ValueSpec:
+							for _, ident := range spec.Names {
+								names = append(names, ident.Name)
+							}
+						}
+					}
+				}
+				for _, ident := range names {
+					if other, ok := declared[ident]; ok && ident != "_" {
+						t.Errorf("%s is declared by the code of both %s and %s", ident, other, name)
+					}
+					declared[ident] = name
+				}
+			}
+		}
+	}
+}
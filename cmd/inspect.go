@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"gewh/core"
+	"io"
+	"os"
+	"strings"
+)
+
+const inspectUsage = `usage: gewh inspect [flags] [file]
+
+Prints encoded messages read from file, or stdin when it is missing or -, as JSON or as a
+hex dump with the field boundaries marked. Input starting with the frame magic is read as
+back-to-back frames, anything else as a single unframed binary payload. With -encode it
+reads JSON payloads, bare or as printed by inspect, and writes them encoded.
+`
+
+// bytes every frame starts with
+var frameMagic = []byte("GEWH")
+
+// runs gewh inspect with the arguments that follow the subcommand
+func runInspect(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	format := fs.String("format", "json", "output format: json or hex")
+	encode := fs.Bool("encode", false, "read JSON payloads and write them encoded")
+	framed := fs.Bool("framed", false, "frame encoded messages, implied by -compression, -content and -key")
+	compressionName := fs.String("compression", "none", "compression of encoded Data: none, flate, gzip, zlib or lzw")
+	contentName := fs.String("content", "binary", "encoding of encoded payloads: binary, json or msgpack")
+	keyHex := fs.String("key", "", "hex AES key to encrypt or decrypt the Data of every client with")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), inspectUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var keys core.KeyProvider
+	if *keyHex != "" {
+		key, err := hex.DecodeString(*keyHex)
+		if err != nil {
+			return fmt.Errorf("bad key: %w", err)
+		}
+		keys = core.KeyProviderFunc(func(uint16) ([]byte, error) { return key, nil })
+	}
+
+	in := stdin
+	if name := fs.Arg(0); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	if *encode {
+		var opts []core.SerialisableOpt
+		if *framed {
+			opts = append(opts, core.WithFraming())
+		}
+		compression, err := core.ParseCompression(*compressionName)
+		if err != nil {
+			return err
+		}
+		if compression != core.CompressionNone {
+			opts = append(opts, core.WithCompression(compression, 0))
+		}
+		content, err := core.ParseContentType(*contentName)
+		if err != nil {
+			return err
+		}
+		if content != core.ContentBinary {
+			opts = append(opts, core.WithContentType(content))
+		}
+		if keys != nil {
+			opts = append(opts, core.WithEncryption(keys))
+		}
+		return encodeMessages(in, stdout, opts)
+	}
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "json":
+		return printJSON(stdout, data, keys)
+	case "hex":
+		return printHex(stdout, data)
+	}
+	return fmt.Errorf("unknown format %q", *format)
+}
+
+// a message found in the input
+type message struct {
+	offset int               // where it starts in the input
+	raw    []byte            // the encoded message, frame included
+	header *core.FrameHeader // nil for unframed messages and frames whose header is broken
+	err    error             // why the frame is invalid
+}
+
+// split the input into back-to-back frames when it starts with the frame magic, otherwise it
+// is a single unframed message. A broken frame ends the input since the next one cannot be found.
+func splitMessages(data []byte) []message {
+	if !bytes.HasPrefix(data, frameMagic) {
+		return []message{{raw: data}}
+	}
+	var messages []message
+	for offset := 0; offset < len(data); {
+		rest := data[offset:]
+		header, err := core.ParseFrameHeader(rest)
+		if err == nil && int(header.Length) > len(rest) {
+			err = fmt.Errorf("%w: frame of %d bytes has %d left", core.ErrTruncated, header.Length, len(rest))
+		}
+		if err != nil {
+			return append(messages, message{offset: offset, raw: rest, err: err})
+		}
+		frame := rest[:header.Length]
+		_, _, err = core.ParseFrame(frame)
+		messages = append(messages, message{offset, frame, &header, err})
+		offset += len(frame)
+	}
+	return messages
+}
+
+// JSON form of a message
+type inspected struct {
+	Offset  int           `json:"offset"`
+	Length  int           `json:"length"`
+	Frame   *frameInfo    `json:"frame,omitempty"`
+	Payload *core.Payload `json:"payload,omitempty"`
+	Sealed  bool          `json:"sealed,omitempty"` // Data is still encrypted, no key was given
+	Error   string        `json:"error,omitempty"`
+}
+
+type frameInfo struct {
+	Version     uint8  `json:"version"`
+	Flags       uint8  `json:"flags"`
+	Compression string `json:"compression"`
+	Encrypted   bool   `json:"encrypted"`
+	Content     string `json:"content"`
+	Length      uint32 `json:"length"`
+}
+
+// decode the message as it was encoded, encrypted Data is left sealed when there are no keys
+func (m message) inspect(keys core.KeyProvider) inspected {
+	out := inspected{Offset: m.offset, Length: len(m.raw)}
+	if m.header != nil {
+		out.Frame = &frameInfo{
+			Version:     m.header.Version,
+			Flags:       m.header.Flags,
+			Compression: m.header.Compression().String(),
+			Encrypted:   m.header.Encrypted(),
+			Content:     m.header.ContentType.String(),
+			Length:      m.header.Length,
+		}
+	}
+	if m.err != nil {
+		out.Error = m.err.Error()
+		return out
+	}
+
+	var opts []core.SerialisableOpt
+	if m.header != nil {
+		opts = append(opts, core.WithFraming())
+		if keys != nil {
+			opts = append(opts, core.WithEncryption(keys))
+		}
+	}
+	s := core.NewSerialisable(opts...)
+	s.InsertDataToSerialisableBuffer(m.raw)
+	var err error
+	if out.Sealed = m.header != nil && m.header.Encrypted() && keys == nil; out.Sealed {
+		out.Payload, err = s.PeekPayload()
+	} else {
+		out.Payload, err = s.DecodeOriginalPayload()
+	}
+	if err != nil {
+		out.Error = err.Error()
+	}
+	return out
+}
+
+func printJSON(w io.Writer, data []byte, keys core.KeyProvider) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	for _, m := range splitMessages(data) {
+		if err := enc.Encode(m.inspect(keys)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// named byte range of a message
+type span struct {
+	name       string
+	start, end int
+}
+
+// walks a binary layout, recording a span for every field it reads
+type spanWalker struct {
+	b      []byte
+	base   int // offset of b in the input
+	pos    int
+	spans  []span
+	failed bool // a field ran past the end, the rest is left unparsed
+}
+
+func (w *spanWalker) take(name string, n uint64) []byte {
+	if w.failed || n > uint64(len(w.b)-w.pos) {
+		w.failed = true
+		return nil
+	}
+	field := w.b[w.pos : w.pos+int(n)]
+	w.spans = append(w.spans, span{name, w.base + w.pos, w.base + w.pos + int(n)})
+	w.pos += int(n)
+	return field
+}
+
+func (w *spanWalker) uint16(name string) (uint16, bool) {
+	field := w.take(name, 2)
+	if field == nil {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint16(field), true
+}
+
+func (w *spanWalker) uint32(name string) (uint32, bool) {
+	field := w.take(name, 4)
+	if field == nil {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(field), true
+}
+
+// a uint32 length prefixed field
+func (w *spanWalker) prefixed(name string) {
+	if length, ok := w.uint32(name + ".length"); ok {
+		w.take(name, uint64(length))
+	}
+}
+
+// the spans read so far followed by whatever is left
+func (w *spanWalker) finish() []span {
+	if w.pos < len(w.b) {
+		w.spans = append(w.spans, span{"unparsed", w.base + w.pos, w.base + len(w.b)})
+	}
+	return w.spans
+}
+
+// spans of the binary payload layout in body, see docs/wire-format.md
+func payloadSpans(body []byte, base int) []span {
+	w := &spanWalker{b: body, base: base}
+	version, ok := w.uint16("version")
+	w.uint16("clientId")
+	w.prefixed("identifier")
+	w.prefixed("data")
+	if !ok || version < 2 {
+		return w.finish()
+	}
+	count, _ := w.uint32("headers.count")
+	for i := 0; i < int(count) && !w.failed; i++ {
+		w.prefixed(fmt.Sprintf("headers[%d].key", i))
+		w.prefixed(fmt.Sprintf("headers[%d].value", i))
+	}
+	for i := 0; w.pos < len(w.b) && !w.failed; i++ {
+		w.uint16(fmt.Sprintf("tagged[%d].tag", i))
+		w.prefixed(fmt.Sprintf("tagged[%d].value", i))
+	}
+	return w.finish()
+}
+
+// spans of a message, the frame around it included
+func (m message) spans() []span {
+	if m.header == nil {
+		if m.err != nil {
+			return []span{{"unparsed", m.offset, m.offset + len(m.raw)}}
+		}
+		return payloadSpans(m.raw, m.offset)
+	}
+	w := &spanWalker{b: m.raw[:core.FrameHeaderSize], base: m.offset}
+	w.take("frame.magic", 4)
+	w.take("frame.version", 1)
+	w.take("frame.flags", 1)
+	w.take("frame.content", 1)
+	w.take("frame.reserved", 1)
+	w.take("frame.length", 4)
+	spans := w.spans
+
+	end := len(m.raw) - core.FrameTrailerSize
+	body, base := m.raw[core.FrameHeaderSize:end], m.offset+core.FrameHeaderSize
+	if m.header.ContentType == core.ContentBinary {
+		spans = append(spans, payloadSpans(body, base)...)
+	} else {
+		spans = append(spans, span{"body (" + m.header.ContentType.String() + ")", base, base + len(body)})
+	}
+	return append(spans, span{"frame.checksum", m.offset + end, m.offset + len(m.raw)})
+}
+
+// bytes shown on a line of the hex dump
+const hexLineWidth = 16
+
+func printHex(w io.Writer, data []byte) error {
+	for i, m := range splitMessages(data) {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "# message %d at offset %d, %d bytes\n", i, m.offset, len(m.raw))
+		for _, s := range m.spans() {
+			name := s.name
+			for start := s.start; start < s.end || name != ""; start += hexLineWidth {
+				end := min(start+hexLineWidth, s.end)
+				line := fmt.Sprintf("%08x  %-*s %s", start, hexLineWidth*3, hexBytes(data[start:end]), name)
+				fmt.Fprintln(w, strings.TrimRight(line, " "))
+				name = ""
+			}
+		}
+		if m.err != nil {
+			fmt.Fprintf(w, "# error: %v\n", m.err)
+		}
+	}
+	return nil
+}
+
+// bytes as space separated hex pairs
+func hexBytes(b []byte) string {
+	var sb strings.Builder
+	for i, c := range b {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		fmt.Fprintf(&sb, "%02x", c)
+	}
+	return sb.String()
+}
+
+// encode the JSON payloads read from r and write them to w
+func encodeMessages(r io.Reader, w io.Writer, opts []core.SerialisableOpt) error {
+	dec := json.NewDecoder(r)
+	for i := 0; ; i++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("message %d: %w", i, err)
+		}
+		// accept the output of inspect as well as bare payloads
+		var wrapped inspected
+		if err := json.Unmarshal(raw, &wrapped); err != nil {
+			return fmt.Errorf("message %d: %w", i, err)
+		}
+		if wrapped.Sealed {
+			return fmt.Errorf("message %d: Data is still encrypted, inspect it with -key first", i)
+		}
+		payload := wrapped.Payload
+		if payload == nil {
+			payload = &core.Payload{}
+			if err := json.Unmarshal(raw, payload); err != nil {
+				return fmt.Errorf("message %d: %w", i, err)
+			}
+		}
+
+		s := core.NewSerialisable(opts...)
+		if i > 0 && !s.IsFramed() {
+			return fmt.Errorf("message %d: unframed messages cannot be told apart, use -framed", i)
+		}
+		if err := s.EncodePayload(payload); err != nil {
+			return fmt.Errorf("message %d: %w", i, err)
+		}
+		if _, err := w.Write(s.Bytes()); err != nil {
+			return err
+		}
+	}
+}
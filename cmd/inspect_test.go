@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"gewh/core"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func inspect(t *testing.T, input []byte, args ...string) ([]byte, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := runInspect(args, bytes.NewReader(input), &out)
+	return out.Bytes(), err
+}
+
+// decode the JSON documents printed by inspect
+func inspectedMessages(t *testing.T, out []byte) []inspected {
+	t.Helper()
+	var messages []inspected
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var m inspected
+		require.NoError(t, dec.Decode(&m))
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+func TestInspectRoundTrip(t *testing.T) {
+	input := `{"version":2,"clientId":42,"identifier":"b3JpZ2lu","data":"SGVsbG8=","headers":[{"key":"route","value":"eu"}]}
+{"version":1,"clientId":7,"identifier":null,"data":"V29ybGQ="}`
+
+	encoded, err := inspect(t, []byte(input), "-encode", "-framed")
+	require.NoError(t, err)
+
+	out, err := inspect(t, encoded)
+	require.NoError(t, err)
+	messages := inspectedMessages(t, out)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "Hello", string(messages[0].Payload.Data))
+	assert.Equal(t, core.Headers{{Key: "route", Value: "eu"}}, messages[0].Payload.Headers)
+	assert.Equal(t, uint16(1), messages[1].Payload.Version, "versions are shown as encoded")
+	assert.Equal(t, messages[0].Length, messages[1].Offset)
+	assert.Equal(t, "binary", messages[1].Frame.Content)
+
+	// the output of inspect encodes back to the same bytes
+	again, err := inspect(t, out, "-encode", "-framed")
+	require.NoError(t, err)
+	assert.Equal(t, encoded, again)
+
+	_, err = inspect(t, []byte(input), "-encode")
+	assert.ErrorContains(t, err, "-framed", "unframed messages cannot be concatenated")
+}
+
+func TestInspectHex(t *testing.T) {
+	encoded, err := inspect(t, []byte(`{"version":2,"clientId":1,"identifier":"aWQ=","data":"MDEyMzQ1Njc4OWFiY2RlZjAxMjM="}`), "-encode")
+	require.NoError(t, err)
+	out, err := inspect(t, encoded, "-format", "hex")
+	require.NoError(t, err)
+
+	dump := string(out)
+	assert.Contains(t, dump, "00000000  02 00")
+	assert.Contains(t, dump, "00000008  69 64")
+	assert.Contains(t, dump, "identifier\n")
+	assert.Contains(t, dump, "0000000e  30 31 32 33 34 35 36 37 38 39 61 62 63 64 65 66  data\n")
+	assert.Contains(t, dump, "0000001e  30 31 32 33\n", "long fields wrap without their name")
+	assert.Contains(t, dump, "00000022  00 00 00 00                                      headers.count\n")
+
+	framed, err := inspect(t, []byte(`{"version":2,"clientId":1,"identifier":"","data":""}`), "-encode", "-content", "json")
+	require.NoError(t, err)
+	out, err = inspect(t, framed, "-format", "hex")
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "body (json)")
+	assert.Contains(t, string(out), "frame.checksum")
+}
+
+func TestInspectBrokenAndEncrypted(t *testing.T) {
+	payload := []byte(`{"version":2,"clientId":3,"identifier":"aWQ=","data":"c2VjcmV0"}`)
+
+	t.Run("test encrypted data stays sealed without a key", func(t *testing.T) {
+		encoded, err := inspect(t, payload, "-encode", "-key", testKey)
+		require.NoError(t, err)
+
+		out, err := inspect(t, encoded)
+		require.NoError(t, err)
+		messages := inspectedMessages(t, out)
+		require.Len(t, messages, 1)
+		assert.True(t, messages[0].Sealed)
+		assert.True(t, messages[0].Frame.Encrypted)
+		assert.NotEqual(t, "secret", string(messages[0].Payload.Data))
+		_, err = inspect(t, out, "-encode")
+		assert.Error(t, err, "sealed payloads cannot be encoded again")
+
+		out, err = inspect(t, encoded, "-key", testKey)
+		require.NoError(t, err)
+		messages = inspectedMessages(t, out)
+		assert.False(t, messages[0].Sealed)
+		assert.Equal(t, "secret", string(messages[0].Payload.Data))
+	})
+
+	t.Run("test broken frames are reported", func(t *testing.T) {
+		encoded, err := inspect(t, payload, "-encode", "-framed")
+		require.NoError(t, err)
+		encoded[len(encoded)-1] ^= 0xff
+		truncated := append(append([]byte{}, encoded...), encoded[:len(encoded)-2]...)
+
+		out, err := inspect(t, truncated)
+		require.NoError(t, err)
+		messages := inspectedMessages(t, out)
+		require.Len(t, messages, 2)
+		assert.Contains(t, messages[0].Error, "checksum")
+		assert.Contains(t, messages[1].Error, "truncated")
+
+		out, err = inspect(t, truncated, "-format", "hex")
+		require.NoError(t, err)
+		assert.Equal(t, 2, strings.Count(string(out), "# error:"))
+	})
+}
@@ -2,26 +2,55 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"gewh/core"
 	gio "gewh/io"
 	"gewh/processor"
 	"log"
+	"log/slog"
 	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 	// ... other imports
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "inspect" {
+		if err := runInspect(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				os.Exit(2)
+			}
+			log.Fatalf("inspect: %v", err)
+		}
+		return
+	}
+
 	// Your existing flags
 	inputPath := flag.String("input", "/Users/vasilieiosvamvakas/Documents/projects/gewh/data/weather_data.csv", "input path in .csv format")
-	batchSize := flag.Int("batch", 1000000, "input path in .csv format")
+	batchSize := flag.Int("batch", gio.DefaultBatchSize, "rows per batch, larger batches may exceed the decode limits")
 	verbose := flag.Bool("v", false, "print verbose output to console")
 	outputPath := flag.String("output", "/Users/vasilieiosvamvakas/Documents/projects/gewh/data/output_data.csv", "input path in .csv format")
 	numWorkers := flag.Int("workers", core.MAX_WORKER, "number of workers per dispatcher")
 	queueSize := flag.Int("queue", core.MAX_QUEUE, "size of the request queue")
+	compressionName := flag.String("compression", "none", "compression of request data: none, flate, gzip, zlib or lzw")
+	contentName := flag.String("content", "binary", "encoding of request payloads: binary, json or msgpack")
+	ttl := flag.Duration("ttl", 0, "drop requests that are not processed within this duration, 0 keeps them")
+	dedupWindow := flag.Duration("dedup", 0, "drop batches seen again within this duration, 0 turns deduplication off")
+	attempts := flag.Int("attempts", 1, "attempts at processing a batch before it is given up on")
 	flag.Parse()
 
+	compression, err := core.ParseCompression(*compressionName)
+	if err != nil {
+		log.Fatalf("err: %v ", err)
+	}
+	content, err := core.ParseContentType(*contentName)
+	if err != nil {
+		log.Fatalf("err: %v ", err)
+	}
+
 	// Set up logging
 	if !*verbose {
 		os.Stdout = nil
@@ -34,7 +63,14 @@ func main() {
 		log.Fatalf("err: %v ", err)
 	}
 
-	producer := core.NewProducer(core.WithBroadcastTimeout[core.Request](5 * time.Second))
+	producer := core.NewProducer(
+		core.WithBroadcastTimeout[core.Request](5*time.Second),
+		core.WithPayloadCompression(compression, core.DefaultCompressionThreshold),
+		core.WithPayloadContentType(content),
+		core.WithPayloadTTL(*ttl),
+		core.WithPooledRequests(),
+		core.WithoutResultPayloads(),
+	)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -43,22 +79,53 @@ func main() {
 	dispatcher := core.NewDispatcher(1, *numWorkers)
 	queue := make(core.RequestQueue, *queueSize)
 	dispatcher.AddQueue(queue)
+	if *dedupWindow > 0 {
+		dispatcher.AddStage(core.NewDeduplicator(core.WithDedupWindow(*dedupWindow)))
+	}
+	if *attempts > 1 {
+		dispatcher.AddRetryPolicy(core.NewRetryPolicy(core.WithMaxAttempts(*attempts)))
+	}
+	dispatcher.Use(core.Recover())
+	if *verbose {
+		dispatcher.Use(core.Logging(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	}
 	producer.Subscribe(dispatcher)
 
 	p := processor.NewProcessor(processor.WeatherMapFunc, processor.WeatherReduce())
 	dispatcher.Run(p)
 
 	processingStartTime := time.Now()
+	var pending sync.WaitGroup
+	var failed atomic.Int64
 	batchChan, _ := reader.ReadRecords()
 	for rawBatch := range batchChan {
-		batch := gio.CombineRecords(rawBatch)
-		req := core.NewRequest(int(batch.Id), core.NewSerialisable(), context.Background())
-		payload := core.NewPayload(uint16(1), uint16(1), []byte("origin"), []byte(batch.Value))
-		req.AddPayload(payload)
-		producer.Broadcast(ctx, req)
+		batch, err := gio.EnvelopeRecords(rawBatch)
+		if err != nil {
+			log.Fatalf("err: %v ", err)
+		}
+		// the identifier is unique per batch so retried broadcasts can be deduplicated
+		identifier := strconv.AppendUint([]byte("batch-"), batch.Id, 10)
+		payload := core.NewPayload(core.CurrentPayloadVersion, uint16(1), identifier, batch.Envelope)
+		payload.SetHeader("content-type", core.BatchContentType)
+		req, err := producer.NewRequest(int(batch.Id), payload, context.Background())
+		if err != nil {
+			log.Fatalf("err: %v ", err)
+		}
+		id := req.Id
+		pending.Add(1)
+		producer.Publish(ctx, req).OnComplete(func(_ *core.Payload, err error) {
+			defer pending.Done()
+			if err != nil {
+				failed.Add(1)
+				log.Printf("batch %d failed: %v", id, err)
+			}
+		})
 	}
-	p.Wait()
+	pending.Wait()
 	processingEndTime := time.Now()
+	if n := failed.Load(); n > 0 {
+		log.Printf("%d batches failed", n)
+	}
 
 	dispatcher.Stop()
 
@@ -0,0 +1,182 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Batch envelope carrying many records, usually in the Data of one payload. Layout
+// (little-endian):
+//
+//	count   uint32
+//	index   count × {offset uint32, length uint32}, offsets are relative to the records
+//	records []byte
+//
+// Records are opaque bytes, such as encoded payloads or nested envelopes, and can be
+// walked in order with an iterator or read by index without parsing the others.
+
+// value of the content-type header of payloads whose Data is a batch envelope
+const BatchContentType = "application/gewh-batch"
+
+const batchIndexEntrySize = 8
+
+// builds a batch envelope one record at a time
+type BatchBuilder struct {
+	index   []byte
+	records []byte
+}
+
+func NewBatchBuilder() *BatchBuilder {
+	return &BatchBuilder{}
+}
+
+// add a record to the end of the batch
+func (b *BatchBuilder) Add(record []byte) error {
+	if uint64(len(b.records))+uint64(len(record)) > math.MaxUint32 || b.Len() == math.MaxUint32 {
+		return fmt.Errorf("%w: batch does not fit in uint32 offsets", ErrLengthTooLarge)
+	}
+	b.index = binary.LittleEndian.AppendUint32(b.index, uint32(len(b.records)))
+	b.index = binary.LittleEndian.AppendUint32(b.index, uint32(len(record)))
+	b.records = append(b.records, record...)
+	return nil
+}
+
+// add a payload encoded with AppendBinary
+func (b *BatchBuilder) AddPayload(payload *Payload) error {
+	record, err := payload.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return b.Add(record)
+}
+
+// number of records added
+func (b *BatchBuilder) Len() int {
+	return len(b.index) / batchIndexEntrySize
+}
+
+// number of bytes the envelope takes
+func (b *BatchBuilder) Size() int {
+	return 4 + len(b.index) + len(b.records)
+}
+
+// append the envelope to dst
+func (b *BatchBuilder) AppendTo(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(b.Len()))
+	dst = append(dst, b.index...)
+	return append(dst, b.records...)
+}
+
+// the envelope
+func (b *BatchBuilder) Bytes() []byte {
+	return b.AppendTo(make([]byte, 0, b.Size()))
+}
+
+// remove all records, keeping the allocated memory
+func (b *BatchBuilder) Reset() {
+	b.index = b.index[:0]
+	b.records = b.records[:0]
+}
+
+// a parsed batch envelope, records alias the data it was parsed from
+type Batch struct {
+	index   []byte
+	records []byte
+}
+
+// parse and validate a batch envelope, every index entry is checked so records can be
+// read without further checks
+func ParseBatch(data []byte) (*Batch, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("%w: %d bytes is too short for a batch count", ErrTruncated, len(data))
+	}
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+	if uint64(count)*batchIndexEntrySize > uint64(len(data)) {
+		return nil, fmt.Errorf("%w: index of %d records does not fit in %d bytes", ErrTruncated, count, len(data))
+	}
+	b := &Batch{
+		index:   data[:count*batchIndexEntrySize],
+		records: data[count*batchIndexEntrySize:],
+	}
+	for i := 0; i < b.Len(); i++ {
+		offset, length := b.entry(i)
+		if uint64(offset)+uint64(length) > uint64(len(b.records)) {
+			return nil, fmt.Errorf("%w: record %d at %d+%d exceeds the %d record bytes", ErrBadBatch, i, offset, length, len(b.records))
+		}
+	}
+	return b, nil
+}
+
+// parse the Data of the payload as a batch envelope
+func (p *Payload) Batch() (*Batch, error) {
+	return ParseBatch(p.Data)
+}
+
+func (b *Batch) entry(i int) (uint32, uint32) {
+	entry := b.index[i*batchIndexEntrySize:]
+	return binary.LittleEndian.Uint32(entry), binary.LittleEndian.Uint32(entry[4:])
+}
+
+// number of records
+func (b *Batch) Len() int {
+	return len(b.index) / batchIndexEntrySize
+}
+
+// get record i
+func (b *Batch) Record(i int) ([]byte, error) {
+	if i < 0 || i >= b.Len() {
+		return nil, fmt.Errorf("%w: record %d of %d", ErrIndexOutOfRange, i, b.Len())
+	}
+	offset, length := b.entry(i)
+	return b.records[offset : offset+length : offset+length], nil
+}
+
+// decode record i as a payload encoded with AppendBinary
+func (b *Batch) Payload(i int) (*Payload, error) {
+	record, err := b.Record(i)
+	if err != nil {
+		return nil, err
+	}
+	payload := &Payload{}
+	if err := payload.UnmarshalBinary(record); err != nil {
+		return nil, fmt.Errorf("record %d: %w", i, err)
+	}
+	return payload, nil
+}
+
+// iterator over the records, in order
+func (b *Batch) Iter() *BatchIterator {
+	return &BatchIterator{batch: b, i: -1}
+}
+
+// walks the records of a batch:
+//
+//	it := batch.Iter()
+//	for it.Next() {
+//	    process(it.Record())
+//	}
+type BatchIterator struct {
+	batch *Batch
+	i     int
+}
+
+// advance to the next record, false when there are none left
+func (it *BatchIterator) Next() bool {
+	if it.i < it.batch.Len() {
+		it.i++
+	}
+	return it.i < it.batch.Len()
+}
+
+// index of the current record
+func (it *BatchIterator) Index() int {
+	return it.i
+}
+
+// the current record
+func (it *BatchIterator) Record() []byte {
+	record, _ := it.batch.Record(it.i)
+	return record
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	records := [][]byte{[]byte("Helsinki;15.0"), {}, []byte("London, UK"), bytes.Repeat([]byte{0}, 300)}
+	newBatch := func() []byte {
+		builder := NewBatchBuilder()
+		for _, record := range records {
+			if err := builder.Add(record); err != nil {
+				t.Fatalf("adding record failed: %v", err)
+			}
+		}
+		return builder.Bytes()
+	}
+
+	t.Run("test layout", func(t *testing.T) {
+		builder := NewBatchBuilder()
+		builder.Add([]byte("ab"))
+		builder.Add([]byte("c"))
+		want := []byte{
+			2, 0, 0, 0,
+			0, 0, 0, 0, 2, 0, 0, 0,
+			2, 0, 0, 0, 1, 0, 0, 0,
+			'a', 'b', 'c',
+		}
+		if got := builder.Bytes(); !bytes.Equal(got, want) {
+			t.Errorf("layout mismatch:\ngot  %v\nwant %v", got, want)
+		}
+		if builder.Size() != len(want) {
+			t.Errorf("expected size %d, got %d", len(want), builder.Size())
+		}
+
+		builder.Reset()
+		if got := builder.Bytes(); !bytes.Equal(got, []byte{0, 0, 0, 0}) || builder.Len() != 0 {
+			t.Errorf("expected empty batch after reset, got %v", got)
+		}
+	})
+
+	t.Run("test iteration", func(t *testing.T) {
+		batch, err := ParseBatch(newBatch())
+		if err != nil {
+			t.Fatalf("parsing failed: %v", err)
+		}
+		var got [][]byte
+		it := batch.Iter()
+		for it.Next() {
+			if it.Index() != len(got) {
+				t.Errorf("expected index %d, got %d", len(got), it.Index())
+			}
+			got = append(got, it.Record())
+		}
+		if it.Next() {
+			t.Errorf("expected iteration to stay finished")
+		}
+		if !reflect.DeepEqual(got, records) {
+			t.Errorf("records mismatch: got %q", got)
+		}
+	})
+
+	t.Run("test random access", func(t *testing.T) {
+		batch, _ := ParseBatch(newBatch())
+		for _, i := range []int{3, 0, 2, 1} {
+			got, err := batch.Record(i)
+			if err != nil || !bytes.Equal(got, records[i]) {
+				t.Errorf("record %d: got %q (%v)", i, got, err)
+			}
+		}
+		for _, i := range []int{-1, len(records)} {
+			if _, err := batch.Record(i); !errors.Is(err, ErrIndexOutOfRange) {
+				t.Errorf("record %d: expected ErrIndexOutOfRange, got %v", i, err)
+			}
+		}
+
+		// appending to a record must not overwrite the next one
+		first, _ := batch.Record(0)
+		_ = append(first, 'x')
+		if third, _ := batch.Record(2); !bytes.Equal(third, records[2]) {
+			t.Errorf("record 2 was overwritten: %q", third)
+		}
+	})
+
+	t.Run("test payload records", func(t *testing.T) {
+		payloads := []*Payload{
+			NewPayload(CurrentPayloadVersion, 1, []byte("a"), []byte("first")),
+			NewPayload(CurrentPayloadVersion, 2, []byte("b"), []byte("second")),
+		}
+		payloads[1].AddHeader("route", "eu")
+		builder := NewBatchBuilder()
+		for _, payload := range payloads {
+			if err := builder.AddPayload(payload); err != nil {
+				t.Fatalf("adding payload failed: %v", err)
+			}
+		}
+		batch, _ := ParseBatch(builder.Bytes())
+		for i, want := range payloads {
+			got, err := batch.Payload(i)
+			if err != nil || !reflect.DeepEqual(got, want) {
+				t.Errorf("payload %d: got %v (%v)", i, got, err)
+			}
+		}
+
+		builder.Add([]byte{1})
+		batch, _ = ParseBatch(builder.Bytes())
+		if _, err := batch.Payload(2); !errors.Is(err, ErrTruncated) {
+			t.Errorf("expected ErrTruncated for a record that is not a payload, got %v", err)
+		}
+	})
+
+	t.Run("test batch through a serialisable", func(t *testing.T) {
+		s := NewSerialisable(WithCompression(CompressionZlib, DefaultCompressionThreshold))
+		payload := NewPayload(CurrentPayloadVersion, 1, []byte("origin"), newBatch())
+		payload.SetHeader("content-type", BatchContentType)
+		if err := s.EncodePayload(payload); err != nil {
+			t.Fatalf("encoding failed: %v", err)
+		}
+		decoded, err := s.DecodePayload()
+		if err != nil {
+			t.Fatalf("decoding failed: %v", err)
+		}
+		batch, err := decoded.Batch()
+		if err != nil || batch.Len() != len(records) {
+			t.Fatalf("expected %d records, got %v (%v)", len(records), batch, err)
+		}
+		if got, _ := batch.Record(2); !bytes.Equal(got, records[2]) {
+			t.Errorf("record mismatch: got %q", got)
+		}
+	})
+
+	t.Run("test empty batch", func(t *testing.T) {
+		batch, err := ParseBatch(NewBatchBuilder().Bytes())
+		if err != nil || batch.Len() != 0 || batch.Iter().Next() {
+			t.Errorf("expected empty batch, got %v (%v)", batch, err)
+		}
+	})
+
+	t.Run("test malformed batches", func(t *testing.T) {
+		encoded := newBatch()
+		for n := 0; n < 4+len(records)*batchIndexEntrySize; n++ {
+			if _, err := ParseBatch(encoded[:n]); !errors.Is(err, ErrTruncated) {
+				t.Errorf("%d bytes: expected ErrTruncated, got %v", n, err)
+			}
+		}
+		if _, err := ParseBatch(encoded[:len(encoded)-1]); !errors.Is(err, ErrBadBatch) {
+			t.Errorf("expected ErrBadBatch for a short record section, got %v", err)
+		}
+
+		huge := binary.LittleEndian.AppendUint32(nil, 0xffffffff)
+		if _, err := ParseBatch(huge); !errors.Is(err, ErrTruncated) {
+			t.Errorf("expected ErrTruncated for a huge count, got %v", err)
+		}
+
+		overflow := append(binary.LittleEndian.AppendUint32(nil, 1), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+		if _, err := ParseBatch(overflow); !errors.Is(err, ErrBadBatch) {
+			t.Errorf("expected ErrBadBatch for an offset overflow, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Reflection-free encoding of a Payload. The layout is the same one the schema
+// codec writes for PayloadSchema, so both paths can read each other's output.
+
+// size of the fixed part of the version 1 layout: version, client id and the two length prefixes
+const payloadFixedSize = 2 + 2 + 4 + 4
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (p *Payload) MarshalBinary() ([]byte, error) {
+	return p.AppendBinary(make([]byte, 0, p.BinarySize()))
+}
+
+// AppendBinary appends the encoded payload to dst
+func (p *Payload) AppendBinary(dst []byte) ([]byte, error) {
+	if uint64(len(p.Identifier)) > math.MaxUint32 || uint64(len(p.Data)) > math.MaxUint32 {
+		return dst, fmt.Errorf("payload field does not fit in a uint32 length prefix")
+	}
+	if err := p.checkVersion(); err != nil {
+		return dst, err
+	}
+	dst = binary.LittleEndian.AppendUint16(dst, p.Version)
+	dst = binary.LittleEndian.AppendUint16(dst, p.ClientId)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(p.Identifier)))
+	dst = append(dst, p.Identifier...)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(p.Data)))
+	dst = append(dst, p.Data...)
+	if p.Version < 2 {
+		return dst, nil
+	}
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(p.Headers)))
+	for _, header := range p.Headers {
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(len(header.Key)))
+		dst = append(dst, header.Key...)
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(len(header.Value)))
+		dst = append(dst, header.Value...)
+	}
+	return p.Tagged.appendBinary(dst)
+}
+
+// headers and tagged fields need version 2
+func (p *Payload) checkVersion() error {
+	if p.Version >= 2 {
+		return nil
+	}
+	if len(p.Headers) > 0 {
+		return fmt.Errorf("%w: version %d", ErrHeadersUnsupported, p.Version)
+	}
+	if len(p.Tagged) > 0 {
+		return fmt.Errorf("%w: version %d", ErrTaggedUnsupported, p.Version)
+	}
+	return nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, the byte fields are copied out of data
+func (p *Payload) UnmarshalBinary(data []byte) error {
+	return p.unmarshalBinary(data, copyBytes)
+}
+
+// number of bytes AppendBinary will write
+func (p *Payload) BinarySize() int {
+	size := payloadFixedSize + len(p.Identifier) + len(p.Data)
+	if p.Version >= 2 {
+		size += 4
+		for _, header := range p.Headers {
+			size += 8 + len(header.Key) + len(header.Value)
+		}
+		size += p.Tagged.binarySize()
+	}
+	return size
+}
+
+// how decoding fills the byte fields of a payload
+type byteMode uint8
+
+const (
+	aliasBytes byteMode = iota // byte fields alias the encoded message
+	copyBytes                  // byte fields are copied into new slices
+	reuseBytes                 // byte fields are copied into the memory the payload already holds
+)
+
+// the byte field to store for value, old is the field it replaces
+func (m byteMode) take(old, value []byte) []byte {
+	switch m {
+	case copyBytes:
+		return append([]byte{}, value...)
+	case reuseBytes:
+		if taken := append(old[:0], value...); taken != nil {
+			return taken
+		}
+		return []byte{}
+	}
+	return value
+}
+
+// decode data into the payload, mode decides whether byte fields alias data
+func (p *Payload) unmarshalBinary(data []byte, mode byteMode) error {
+	if len(data) < 4 {
+		return fmt.Errorf("%w: %d bytes is too short for a payload header", ErrTruncated, len(data))
+	}
+	p.Version = binary.LittleEndian.Uint16(data[0:2])
+	p.ClientId = binary.LittleEndian.Uint16(data[2:4])
+	rest := data[4:]
+
+	var value []byte
+	var err error
+	if value, rest, err = readPrefixedBytes(rest); err != nil {
+		return fmt.Errorf("field Identifier: %w", err)
+	}
+	p.Identifier = mode.take(p.Identifier, value)
+	if value, rest, err = readPrefixedBytes(rest); err != nil {
+		return fmt.Errorf("field Data: %w", err)
+	}
+	p.Data = mode.take(p.Data, value)
+	p.Headers = nil
+	tagged := p.Tagged
+	p.Tagged = nil
+	if p.Version < 2 {
+		return nil
+	}
+	if p.Headers, rest, err = readHeaders(rest); err != nil {
+		return fmt.Errorf("field Headers: %w", err)
+	}
+	if mode != reuseBytes {
+		tagged = nil
+	}
+	if p.Tagged, err = readTagged(rest, mode, tagged); err != nil {
+		return fmt.Errorf("field Tagged: %w", err)
+	}
+	return nil
+}
+
+// read a count prefixed list of headers from the start of b and return it with the unread bytes
+func readHeaders(b []byte) (Headers, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, fmt.Errorf("%w: missing header count", ErrTruncated)
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	// every header needs at least its two length prefixes
+	if uint64(count)*8 > uint64(len(b)) {
+		return nil, nil, fmt.Errorf("%w: %d headers do not fit in %d bytes", ErrTruncated, count, len(b))
+	}
+	if count == 0 {
+		return nil, b, nil
+	}
+	headers := make(Headers, count)
+	for i := range headers {
+		var key, value []byte
+		var err error
+		if key, b, err = readPrefixedBytes(b); err != nil {
+			return nil, nil, err
+		}
+		if value, b, err = readPrefixedBytes(b); err != nil {
+			return nil, nil, err
+		}
+		headers[i] = Header{string(key), string(value)}
+	}
+	return headers, b, nil
+}
+
+// read a uint32 length prefixed byte slice from the start of b and return it with the unread
+// bytes. The slice shares the memory of b, callers copy it when they need to.
+func readPrefixedBytes(b []byte) ([]byte, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, fmt.Errorf("%w: missing length prefix", ErrTruncated)
+	}
+	length := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	if uint64(length) > uint64(len(b)) {
+		return nil, nil, fmt.Errorf("%w: length %d exceeds the %d bytes left", ErrTruncated, length, len(b))
+	}
+	return b[:length:length], b[length:], nil
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = (*Payload)(nil)
+	_ encoding.BinaryUnmarshaler = (*Payload)(nil)
+)
+
+// encode with the schema codec, which goes through encoding/binary and reflection
+func encodeReflective(t testing.TB, payload *Payload) []byte {
+	s := NewSerialisable()
+	s.Codec.AddSchema(payloadSchemaFor(payload.Version))
+	s.Codec.AddFields(payload.ToFields())
+	if err := s.Encode(); err != nil {
+		t.Fatalf("encoding failed: %v", err)
+	}
+	return s.buf.Bytes()
+}
+
+func TestPayloadBinary(t *testing.T) {
+	large := make([]byte, 1024*1024)
+	rand.Read(large)
+	payloads := []*Payload{
+		NewPayload(1, 42, []byte("custom token"), []byte("Hello, World!")),
+		NewPayload(1, 0, []byte{}, []byte{}),
+		NewPayload(65535, 65535, []byte("origin"), large),
+		{Version: 2, ClientId: 7, Identifier: []byte("origin"), Data: []byte("with headers"), Headers: Headers{
+			{"content-type", "text/csv"},
+			{"trace-id", "4bf92f3577b34da6"},
+			{"empty", ""},
+		}},
+	}
+
+	t.Run("test both paths write identical bytes", func(t *testing.T) {
+		for _, payload := range payloads {
+			want := encodeReflective(t, payload)
+			got, err := payload.MarshalBinary()
+			if err != nil {
+				t.Fatalf("marshaling failed: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("encoded output mismatch for client %d: got %d bytes, want %d bytes", payload.ClientId, len(got), len(want))
+			}
+			if len(got) != payload.BinarySize() {
+				t.Errorf("BinarySize mismatch: got %d, want %d", payload.BinarySize(), len(got))
+			}
+		}
+	})
+
+	t.Run("test both paths read each other", func(t *testing.T) {
+		for _, payload := range payloads {
+			got := Payload{}
+			if err := got.UnmarshalBinary(encodeReflective(t, payload)); err != nil {
+				t.Fatalf("unmarshaling failed: %v", err)
+			}
+			if !reflect.DeepEqual(&got, payload) {
+				t.Errorf("payload mismatch for client %d", payload.ClientId)
+			}
+
+			encoded, _ := payload.MarshalBinary()
+			s := NewSerialisable()
+			s.Codec.AddSchema(payloadSchemaFor(payload.Version))
+			s.InsertDataToSerialisableBuffer(encoded)
+			fields, err := s.Decode()
+			if err != nil {
+				t.Fatalf("decoding failed: %v", err)
+			}
+			fromFields := Payload{}
+			fromFields.FromFields(fields)
+			if !reflect.DeepEqual(&fromFields, payload) {
+				t.Errorf("payload mismatch for client %d", payload.ClientId)
+			}
+		}
+	})
+
+	t.Run("test append keeps existing bytes", func(t *testing.T) {
+		prefix := []byte{0xff, 0xfe}
+		got, err := payloads[0].AppendBinary(prefix)
+		if err != nil {
+			t.Fatalf("appending failed: %v", err)
+		}
+		if !bytes.Equal(got[:2], prefix) || !bytes.Equal(got[2:], encodeReflective(t, payloads[0])) {
+			t.Errorf("unexpected output %#x", got)
+		}
+	})
+
+	t.Run("test truncated input", func(t *testing.T) {
+		encoded, _ := payloads[0].MarshalBinary()
+		for _, n := range []int{0, 3, 7, len(encoded) - 1} {
+			if err := new(Payload).UnmarshalBinary(encoded[:n]); !errors.Is(err, ErrTruncated) {
+				t.Errorf("expected ErrTruncated for %d bytes, got %v", n, err)
+			}
+		}
+	})
+
+	t.Run("test unmarshal does not alias input", func(t *testing.T) {
+		encoded, _ := payloads[0].MarshalBinary()
+		got := Payload{}
+		got.UnmarshalBinary(encoded)
+		for i := range encoded {
+			encoded[i] = 0
+		}
+		if string(got.Data) != "Hello, World!" {
+			t.Errorf("payload changed with input buffer: %q", got.Data)
+		}
+	})
+}
+
+var benchmarkSizes = []int{64, 64 * 1024, 16 * 1024 * 1024}
+
+func benchmarkPayload(size int) *Payload {
+	data := make([]byte, size)
+	rand.Read(data)
+	return NewPayload(CurrentPayloadVersion, 42, []byte("origin"), data)
+}
+
+func BenchmarkPayloadEncode(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		payload := benchmarkPayload(size)
+		b.Run(fmt.Sprintf("reflective/%dB", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				encodeReflective(b, payload)
+			}
+		})
+		b.Run(fmt.Sprintf("append/%dB", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			buf := make([]byte, 0, payload.BinarySize())
+			for i := 0; i < b.N; i++ {
+				buf, _ = payload.AppendBinary(buf[:0])
+			}
+		})
+	}
+}
+
+func BenchmarkPayloadDecode(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		payload := benchmarkPayload(size)
+		encoded, _ := payload.MarshalBinary()
+		b.Run(fmt.Sprintf("reflective/%dB", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			s := NewSerialisable()
+			s.Codec.AddSchema(PayloadSchema)
+			s.InsertDataToSerialisableBuffer(encoded)
+			for i := 0; i < b.N; i++ {
+				fields, err := s.Decode()
+				if err != nil {
+					b.Fatal(err)
+				}
+				new(Payload).FromFields(fields)
+			}
+		})
+		b.Run(fmt.Sprintf("unmarshal/%dB", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				if err := new(Payload).UnmarshalBinary(encoded); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -2,23 +2,29 @@ package core
 
 import (
 	"bytes"
-	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"log"
 	"reflect"
-	"strings"
 )
 
 // Defines the contract for managing fields in a Codec.
 type Codec interface {
 	AddFields(fields ByteFields) // Adds Fields for the specific Codec
 	GetFields() ByteFields       // Gets all Fields for the specific Codec
+	AddSchema(schema Schema)     // Adds the wire layout for the specific Codec
+	GetSchema() Schema           // Gets the wire layout, nil when it should be inferred from the fields
 }
 
 // Codec for base messages we will be handling
 type MessageCodec struct {
 	fields ByteFields // bytefields configured for the specific Codec
+	schema Schema     // layout used to encode and decode the fields
+}
+
+// creates a codec with a fixed layout
+func NewMessageCodec(schema Schema) *MessageCodec {
+	return &MessageCodec{schema: schema}
 }
 
 // add fields to Codec
@@ -31,6 +37,16 @@ func (c *MessageCodec) GetFields() ByteFields {
 	return c.fields
 }
 
+// add schema to Codec
+func (c *MessageCodec) AddSchema(schema Schema) {
+	c.schema = schema
+}
+
+// get schema from Codec
+func (c *MessageCodec) GetSchema() Schema {
+	return c.schema
+}
+
 // data has to be first be transformed to a Bytefield to be encoded and written on the Codec
 type ByteField struct {
 	Name     string       // name of the field
@@ -48,160 +64,350 @@ type BaseSerialisable interface {
 
 // anything that can be serialised and deserialised
 type Serialisable struct {
-	buf   *bytes.Buffer // holds binary data
-	Codec Codec         // holds information on how to decode and encode the binary data
+	buf      *bytes.Buffer  // holds binary data
+	Codec    Codec          // holds information on how to decode and encode the binary data
+	registry *CodecRegistry // versioned payload layouts, DefaultCodecRegistry when nil
+	framed   bool           // wrap the encoded message in a frame
+
+	compression          Compression // algorithm used for the Data field of payloads
+	compressionThreshold int         // payloads with less Data are not compressed
+	keys                 KeyProvider // encrypts the Data field of payloads when set
+	limits               DecodeLimits
+	content              ContentType // encoding of payloads, recorded in the frame header
+	pooled               bool        // taken with AcquireSerialisable, Release returns it to the pool
+}
+
+type SerialisableOpt func(*Serialisable)
+
+// decode and encode payloads with the layouts of the given registry
+func WithCodecRegistry(registry *CodecRegistry) SerialisableOpt {
+	return func(s *Serialisable) {
+		s.registry = registry
+	}
+}
+
+// wrap encoded messages in a checksummed frame and expect one when decoding
+func WithFraming() SerialisableOpt {
+	return func(s *Serialisable) {
+		s.framed = true
+	}
 }
 
-func NewSerialisable() *Serialisable {
-	return &Serialisable{
-		bytes.NewBuffer([]byte{}),
-		&MessageCodec{},
+// compress the Data field of payloads of at least threshold bytes, the algorithm is
+// recorded in the frame flags so this implies WithFraming
+func WithCompression(compression Compression, threshold int) SerialisableOpt {
+	return func(s *Serialisable) {
+		s.framed = true
+		s.compression = compression
+		s.compressionThreshold = threshold
 	}
 }
 
+// encrypt the Data field of payloads with AES-GCM under the key of their client and decrypt
+// it when decoding, encryption is recorded in the frame flags so this implies WithFraming
+func WithEncryption(keys KeyProvider) SerialisableOpt {
+	return func(s *Serialisable) {
+		s.framed = true
+		s.keys = keys
+	}
+}
+
+func NewSerialisable(opts ...SerialisableOpt) *Serialisable {
+	s := &Serialisable{
+		buf:   bytes.NewBuffer([]byte{}),
+		Codec: &MessageCodec{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
 // Struct representation of a serialisable's buffer content using its Codec. This format is used as an interface with the serialisable.
 type Payload struct {
-	Version    uint16 `json:"version"`    // version of encoding
-	ClientId   uint16 `json:"clientId"`   // origin client id
-	Identifier []byte `json:"identifier"` // Identifier
-	Data       []byte `json:"data"`       //  data sent
+	Version    uint16       `json:"version"`           // version of encoding
+	ClientId   uint16       `json:"clientId"`          // origin client id
+	Identifier []byte       `json:"identifier"`        // Identifier
+	Data       []byte       `json:"data"`              //  data sent
+	Headers    Headers      `json:"headers,omitempty"` // metadata, only encoded from version 2
+	Tagged     TaggedFields `json:"tagged,omitempty"`  // optional fields, only encoded from version 2
 }
 
 func NewPayload(version uint16, clientId uint16, token []byte, data []byte) *Payload {
 	return &Payload{
-		version,
-		clientId,
-		token,
-		data,
+		Version:    version,
+		ClientId:   clientId,
+		Identifier: token,
+		Data:       data,
 	}
 }
 
 // Encode method implementation for Serialisable
 func (s *Serialisable) Encode() error {
 	fields := s.Codec.GetFields()
-	tempBuf := new(bytes.Buffer)
-	for _, field := range fields {
-		err := binary.Write(tempBuf, binary.LittleEndian, field.Value)
-		if err != nil {
-			log.Fatalf("Error encoding message %v", err)
-			return err
+	schema, err := s.schema(fields)
+	if err != nil {
+		return err
+	}
+	if err := s.encodeInto(0, ContentBinary, appendFields(schema, fields)); err != nil {
+		return fmt.Errorf("error encoding message: %w", err)
+	}
+	return nil
+}
+
+// append the fields encoded with the given layout
+func appendFields(schema Schema, fields ByteFields) func([]byte) ([]byte, error) {
+	return func(dst []byte) ([]byte, error) {
+		buf := bytes.NewBuffer(dst)
+		if err := encodeFields(NewFieldEncoder(buf), schema, fields); err != nil {
+			return dst, err
 		}
+		return buf.Bytes(), nil
+	}
+}
+
+// replace the buffer with the message appendBody writes, framed with flags if required. The
+// memory of the buffer is reused and it is left empty when encoding fails.
+func (s *Serialisable) encodeInto(flags uint8, content ContentType, appendBody func([]byte) ([]byte, error)) error {
+	if s.buf == nil {
+		s.buf = new(bytes.Buffer)
 	}
-	s.InsertDataToSerialisableBuffer(tempBuf.Bytes())
+	s.buf.Reset()
+	dst := s.buf.AvailableBuffer()
+	var err error
+	if s.framed {
+		dst, err = appendFrameWith(dst, flags, content, appendBody)
+	} else {
+		dst, err = appendBody(dst)
+	}
+	if err != nil {
+		return err
+	}
+	s.buf.Write(dst)
 	return nil
 }
 
+// get the encoded message without its frame, validating the frame if required
+func (s *Serialisable) body() (FrameHeader, []byte, error) {
+	if s.buf == nil {
+		return FrameHeader{}, nil, ErrEmptyBuffer
+	}
+	if err := s.limits.orDefault().checkMessage(s.buf.Len()); err != nil {
+		return FrameHeader{}, nil, err
+	}
+	if !s.framed {
+		return FrameHeader{}, s.buf.Bytes(), nil
+	}
+	return ParseFrame(s.buf.Bytes())
+}
+
+// is the message wrapped in a frame
+func (s *Serialisable) IsFramed() bool {
+	return s.framed
+}
+
 func (s *Serialisable) GetBufString() string {
 	return s.buf.String()
 }
 
+// encoded message in the buffer, it aliases the buffer until the next encode
+func (s *Serialisable) Bytes() []byte {
+	return s.buf.Bytes()
+}
+
 // Decode method implementation for Serialisable
 func (s *Serialisable) Decode() (ByteFields, error) {
 	if s.buf == nil {
-		log.Fatal("Insert Data into buffer of serialisable to decode.")
+		return nil, ErrEmptyBuffer
 	}
-	fields := s.Codec.GetFields()
+	schema, err := s.schema(s.Codec.GetFields())
+	if err != nil {
+		return nil, err
+	}
+	return s.decodeWith(schema)
+}
 
-	for i := range fields {
-		field := &fields[i]
-		switch field.Name {
-		case "Identifier", "Data":
-			length, err := getLengthForDynamicSizedField(fields, field.Name)
-			if err != nil {
-				log.Printf("Error in Decoding: %v, field value %v", err, field.Value)
-			}
-			s.readDataFromDynamicSizedField(field, length)
-		default:
-			// Non-byte arrays: Read values into pointers
-			err := binary.Read(s.buf, binary.LittleEndian, field.Value)
-			if err != nil {
-				return nil, err
-			}
+// decode the buffer with the given layout
+func (s *Serialisable) decodeWith(schema Schema) (ByteFields, error) {
+	_, body, err := s.body()
+	if err != nil {
+		return nil, err
+	}
+	return decodeFields(newLimitedFieldDecoder(body, s.limits), schema)
+}
+
+// encode a payload with the layout registered for its version
+func (s *Serialisable) EncodePayload(payload *Payload) error {
+	registry := s.codecRegistry()
+	schema, err := registry.Schema(payload.Version)
+	if err != nil {
+		return err
+	}
+	if err := payload.checkVersion(); err != nil {
+		return err
+	}
+	if err := payload.Tagged.check(); err != nil {
+		return err
+	}
+	payload, flags, err := compressPayload(payload, s.compression, s.compressionThreshold)
+	if err != nil {
+		return fmt.Errorf("error compressing message: %w", err)
+	}
+	payload, encrypted, err := encryptPayload(payload, s.keys)
+	if err != nil {
+		return fmt.Errorf("error encrypting message: %w", err)
+	}
+	flags |= encrypted
+	s.Codec.AddSchema(schema)
+	// only the schema codec needs the fields, leaving them out keeps the other paths free of allocations
+	s.Codec.AddFields(nil)
+	var appendBody func([]byte) ([]byte, error)
+	if s.content != ContentBinary {
+		codec, err := LookupContentCodec(s.content)
+		if err != nil {
+			return fmt.Errorf("error encoding message: %w", err)
 		}
+		appendBody = func(dst []byte) ([]byte, error) { return codec.AppendPayload(dst, payload) }
+	} else if registry.isNative(payload.Version) {
+		appendBody = payload.AppendBinary
+	} else {
+		s.Codec.AddFields(payload.ToFields())
+		appendBody = appendFields(schema, s.Codec.GetFields())
+	}
+	if err := s.encodeInto(flags, s.content, appendBody); err != nil {
+		return fmt.Errorf("error encoding message: %w", err)
 	}
+	return nil
+}
 
-	return fields, nil
+// decode the buffer into a payload, upgraded to the current version of the registry
+func (s *Serialisable) DecodePayload() (*Payload, error) {
+	return s.codecRegistry().DecodePayload(s)
 }
 
-// get length for a dynamic sized field
-func getLengthForDynamicSizedField(fields ByteFields, fieldName string) (uint32, error) {
-	var length uint32
-	lengthKey := fieldName + "Length"
-	for _, field := range fields {
-		if strings.Compare(field.Name, lengthKey) == 0 {
-			length = *((field).Value.(*uint32))
-		}
+// decode the buffer into p like DecodePayload, copying binary payloads into the memory p
+// already holds so decoding into the same payload again does not allocate. Nothing else may
+// hold on to the byte fields or tagged values of p.
+func (s *Serialisable) DecodePayloadInto(p *Payload) error {
+	return s.codecRegistry().decodePayloadInto(s, p, reuseBytes)
+}
+
+// decode the buffer into a payload like DecodePayload, but keep the version it was encoded with
+func (s *Serialisable) DecodeOriginalPayload() (*Payload, error) {
+	payload := &Payload{}
+	if err := s.codecRegistry().decodeOriginal(s, payload, copyBytes); err != nil {
+		return nil, err
 	}
-	if length == 0 {
-		return 0, fmt.Errorf("invalid key for dynamic shaped field, %s", fieldName)
+	return payload, nil
+}
+
+// decode the buffer into a payload without decrypting or decompressing its Data or upgrading
+// it, enough to read headers and tagged fields of payloads this side cannot decrypt
+func (s *Serialisable) PeekPayload() (*Payload, error) {
+	payload := &Payload{}
+	if _, err := s.codecRegistry().decodeEncoded(s, payload, copyBytes); err != nil {
+		return nil, err
 	}
-	return length, nil
+	return payload, nil
 }
 
-// use length to read data from dynamic sized field
-func (s *Serialisable) readDataFromDynamicSizedField(field *ByteField, fieldSize uint32) error {
-	message := make([]byte, fieldSize)
-	err := binary.Read(s.buf, binary.LittleEndian, &message)
-	if err != nil {
-		return err
+func (s *Serialisable) codecRegistry() *CodecRegistry {
+	if s.registry == nil {
+		return DefaultCodecRegistry
 	}
-	field.Value = message
-	return nil
+	return s.registry
+}
+
+// layout of the message, falls back to the types of the codec fields when no schema is attached
+func (s *Serialisable) schema(fields ByteFields) (Schema, error) {
+	if schema := s.Codec.GetSchema(); schema != nil {
+		return schema, nil
+	}
+	return SchemaFromFields(fields)
 }
 
 // insert raw binary data into the buffer
 func (s *Serialisable) InsertDataToSerialisableBuffer(binaryData []byte) {
 	if s.buf == nil {
-		s.buf = bytes.NewBuffer(binaryData)
-	} else {
-		s.buf.Reset()
-		s.buf.Write(binaryData)
+		s.buf = new(bytes.Buffer)
+	}
+	s.buf.Reset()
+	s.buf.Write(binaryData)
+}
+
+// wire layout of a version 1 Payload
+var PayloadSchemaV1 = Schema{
+	{Name: "Version", Kind: KindUint16},
+	{Name: "ClientId", Kind: KindUint16},
+	{Name: "Identifier", Kind: KindBytes},
+	{Name: "Data", Kind: KindBytes},
+}
+
+// wire layout of the current Payload, version 2 adds headers and the tagged section
+var PayloadSchema = append(append(Schema{}, PayloadSchemaV1...),
+	FieldSpec{Name: "Headers", Kind: KindList, Elem: HeaderSchema},
+	FieldSpec{Name: "Tagged", Kind: KindTagged},
+)
+
+// layout Payload encodes natively for a version
+func payloadSchemaFor(version uint16) Schema {
+	if version < 2 {
+		return PayloadSchemaV1
 	}
+	return PayloadSchema
 }
 
 // transform the binary struct represenatation into fields and then add it to the Codec of the serialisable
-// ToFields converts a Payload to a slice of Fields
+// ToFields converts a Payload to a slice of Fields, headers and tagged fields are only included from version 2
 func (p *Payload) ToFields() ByteFields {
-	tokenLength := uint32(len(p.Identifier))
-	dataLength := uint32(len(p.Data))
-
-	return ByteFields{
+	fields := ByteFields{
 		{"Version", reflect.TypeOf(p.Version), &p.Version},
 		{"ClientId", reflect.TypeOf(p.ClientId), &p.ClientId},
-		{"IdentifierLength", reflect.TypeOf(uint32(0)), &tokenLength},
 		{"Identifier", reflect.TypeOf(p.Identifier), &p.Identifier},
-		{"DataLength", reflect.TypeOf(uint32(0)), &dataLength},
 		{"Data", reflect.TypeOf(p.Data), &p.Data},
 	}
+	if p.Version >= 2 {
+		headers := p.Headers.toFields()
+		fields = append(fields,
+			ByteField{"Headers", reflect.TypeOf(headers), &headers},
+			ByteField{"Tagged", reflect.TypeOf(p.Tagged), &p.Tagged},
+		)
+	}
+	return fields
 }
 
-// transform byte fields into binary representation for processing
-func (b *Payload) FromFields(fields ByteFields) {
+// transform byte fields into binary representation for processing, every known field is
+// applied and the first unknown or mistyped one is reported
+func (b *Payload) FromFields(fields ByteFields) error {
+	var err error
 	for _, field := range fields {
-		switch v := field.Value.(type) {
-		case *uint32:
-			continue
-		case *uint16:
-			switch field.Name {
-			case "Version":
-				b.Version = *v
-			case "ClientId":
-				b.ClientId = *v
-			}
-		case []byte:
-			switch field.Name {
-			case "Data":
-				b.Data = v
-			case "Identifier":
-				b.Identifier = v
-			default:
-				log.Printf("unsupported field name: %v", field.Name)
-			}
+		var ok bool
+		switch field.Name {
+		case "Version":
+			b.Version, ok = FieldValue[uint16](field)
+		case "ClientId":
+			b.ClientId, ok = FieldValue[uint16](field)
+		case "Identifier":
+			b.Identifier, ok = FieldValue[[]byte](field)
+		case "Data":
+			b.Data, ok = FieldValue[[]byte](field)
+		case "Headers":
+			var list []ByteFields
+			list, ok = FieldValue[[]ByteFields](field)
+			b.Headers = headersFromFields(list)
+		case "Tagged":
+			b.Tagged, ok = FieldValue[TaggedFields](field)
 		default:
-			log.Printf("unsupported field type: %v", reflect.TypeOf(field.Value))
+			if err == nil {
+				err = fmt.Errorf("%w: %s", ErrUnknownField, field.Name)
+			}
 			continue
 		}
+		if !ok && err == nil {
+			err = fmt.Errorf("%w: %T for field %s", ErrTypeMismatch, field.Value, field.Name)
+		}
 	}
+	return err
 }
 
 // transform binary representation into json
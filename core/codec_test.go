@@ -16,10 +16,10 @@ func TestEncodingAndDecoding(t *testing.T) {
 		token := "custom token"
 
 		payload := Payload{
-			version,
-			clientId,
-			[]byte(token),
-			[]byte(data),
+			Version:    version,
+			ClientId:   clientId,
+			Identifier: []byte(token),
+			Data:       []byte(data),
 		}
 		testSerialisable := NewSerialisable()
 		fields := payload.ToFields()
@@ -64,10 +64,10 @@ func TestEncodingAndDecoding(t *testing.T) {
 
 		// empty payload that specifies structure
 		payload := Payload{
-			*new(uint16),
-			*new(uint16),
-			[]byte{},
-			[]byte{},
+			Version:    *new(uint16),
+			ClientId:   *new(uint16),
+			Identifier: []byte{},
+			Data:       []byte{},
 		}
 		testSerialisable := NewSerialisable()
 		// get fields from empty payload
@@ -117,10 +117,10 @@ func TestEncodingAndDecoding(t *testing.T) {
 		}
 
 		payload := Payload{
-			*new(uint16),
-			*new(uint16),
-			[]byte{},
-			[]byte{},
+			Version:    *new(uint16),
+			ClientId:   *new(uint16),
+			Identifier: []byte{},
+			Data:       []byte{},
 		}
 		testSerialisable := NewSerialisable()
 		fields := payload.ToFields()
@@ -156,10 +156,10 @@ func TestEncodingAndDecoding(t *testing.T) {
 		inputJsonString := fmt.Sprintf(`{"version":1,"clientId":42,"identifier":"%s","data":"%s"}`, identifier, data)
 
 		payload := Payload{
-			*new(uint16),
-			*new(uint16),
-			[]byte{},
-			[]byte{},
+			Version:    *new(uint16),
+			ClientId:   *new(uint16),
+			Identifier: []byte{},
+			Data:       []byte{},
 		}
 
 		version := uint16(1)
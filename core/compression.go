@@ -0,0 +1,135 @@
+package core
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/lzw"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// algorithm used to compress the Data field of a payload, stored in the low bits of the frame flags
+type Compression uint8
+
+const (
+	CompressionNone Compression = iota
+	CompressionFlate
+	CompressionGzip
+	CompressionZlib
+	CompressionLZW
+)
+
+const (
+	flagCompressionMask uint8 = 0x07 // frame flag bits holding the Compression
+
+	// payloads with less Data than this are sent uncompressed
+	DefaultCompressionThreshold = 1024
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionFlate:
+		return "flate"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZlib:
+		return "zlib"
+	case CompressionLZW:
+		return "lzw"
+	}
+	return fmt.Sprintf("compression(%d)", uint8(c))
+}
+
+// parse the name of a compression algorithm
+func ParseCompression(name string) (Compression, error) {
+	for c := CompressionNone; c <= CompressionLZW; c++ {
+		if c.String() == name {
+			return c, nil
+		}
+	}
+	return CompressionNone, fmt.Errorf("%w: %q", ErrUnknownCompression, name)
+}
+
+// compression recorded in frame flags
+func compressionFromFlags(flags uint8) Compression {
+	return Compression(flags & flagCompressionMask)
+}
+
+func (c Compression) compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionFlate:
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case CompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case CompressionZlib:
+		w = zlib.NewWriter(&buf)
+	case CompressionLZW:
+		w = lzw.NewWriter(&buf, lzw.LSB, 8)
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownCompression, uint8(c))
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c Compression) decompress(data []byte, limit int) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionFlate:
+		r = flate.NewReader(bytes.NewReader(data))
+	case CompressionGzip:
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case CompressionZlib:
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	case CompressionLZW:
+		r = lzw.NewReader(bytes.NewReader(data), lzw.LSB, 8)
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownCompression, uint8(c))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptCompression, err)
+	}
+	defer r.Close()
+	decompressed, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptCompression, err)
+	}
+	if len(decompressed) > limit {
+		return nil, fmt.Errorf("field Data: %w: decompresses to more than %d bytes", ErrLengthTooLarge, limit)
+	}
+	return decompressed, nil
+}
+
+// compress the Data field of the payload if it is large enough and compression pays off.
+// Returns the payload to encode, which is a copy when Data was replaced, and the frame flags.
+func compressPayload(payload *Payload, c Compression, threshold int) (*Payload, uint8, error) {
+	if c == CompressionNone || len(payload.Data) < threshold {
+		return payload, 0, nil
+	}
+	compressed, err := c.compress(payload.Data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(compressed) >= len(payload.Data) {
+		return payload, 0, nil
+	}
+	copied := *payload
+	copied.Data = compressed
+	return &copied, uint8(c), nil
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	data := bytes.Repeat([]byte("Helsinki;15.0,London;16.2,Lisbon;22.3,"), 1000)
+
+	for _, c := range []Compression{CompressionFlate, CompressionGzip, CompressionZlib, CompressionLZW} {
+		t.Run("test round trip with "+c.String(), func(t *testing.T) {
+			payload := NewPayload(1, 42, []byte("origin"), data)
+			s := NewSerialisable(WithCompression(c, DefaultCompressionThreshold))
+			if err := s.EncodePayload(payload); err != nil {
+				t.Fatalf("encoding failed: %v", err)
+			}
+
+			header, _, err := ParseFrame(s.buf.Bytes())
+			if err != nil {
+				t.Fatalf("parsing frame failed: %v", err)
+			}
+			if got := compressionFromFlags(header.Flags); got != c {
+				t.Errorf("frame flag mismatch: got %v, want %v", got, c)
+			}
+			if s.buf.Len() >= len(data) {
+				t.Errorf("expected compressed message, got %d bytes for %d bytes of data", s.buf.Len(), len(data))
+			}
+			if !bytes.Equal(payload.Data, data) {
+				t.Errorf("encoding modified the payload")
+			}
+
+			got, err := s.DecodePayload()
+			if err != nil {
+				t.Fatalf("decoding failed: %v", err)
+			}
+			if !bytes.Equal(got.Data, data) {
+				t.Errorf("data mismatch after decompression")
+			}
+		})
+	}
+
+	t.Run("test payloads below the threshold are not compressed", func(t *testing.T) {
+		s := NewSerialisable(WithCompression(CompressionGzip, len(data)+1))
+		if err := s.EncodePayload(NewPayload(1, 42, []byte("origin"), data)); err != nil {
+			t.Fatalf("encoding failed: %v", err)
+		}
+		header, _, _ := ParseFrame(s.buf.Bytes())
+		if header.Flags != 0 {
+			t.Errorf("expected no compression flag, got %#x", header.Flags)
+		}
+	})
+
+	t.Run("test incompressible payloads are sent as is", func(t *testing.T) {
+		random := make([]byte, 4096)
+		rand.Read(random)
+		s := NewSerialisable(WithCompression(CompressionFlate, 0))
+		if err := s.EncodePayload(NewPayload(1, 42, []byte("origin"), random)); err != nil {
+			t.Fatalf("encoding failed: %v", err)
+		}
+		header, _, _ := ParseFrame(s.buf.Bytes())
+		if header.Flags != 0 {
+			t.Errorf("expected no compression flag, got %#x", header.Flags)
+		}
+		got, err := s.DecodePayload()
+		if err != nil || !bytes.Equal(got.Data, random) {
+			t.Errorf("data mismatch: %v", err)
+		}
+	})
+
+	t.Run("test corrupt compressed data", func(t *testing.T) {
+		body, _ := NewPayload(1, 42, []byte("origin"), []byte("not gzip")).MarshalBinary()
+		s := NewSerialisable(WithFraming())
+		s.InsertDataToSerialisableBuffer(AppendFrame(nil, uint8(CompressionGzip), body))
+		if _, err := s.DecodePayload(); !errors.Is(err, ErrCorruptCompression) {
+			t.Errorf("expected ErrCorruptCompression, got %v", err)
+		}
+	})
+
+	t.Run("test producer option", func(t *testing.T) {
+		producer := NewProducer(WithPayloadCompression(CompressionZlib, 0))
+		req, err := producer.NewRequest(1, NewPayload(1, 42, []byte("origin"), data), context.Background())
+		if err != nil {
+			t.Fatalf("creating request failed: %v", err)
+		}
+		header, _, _ := ParseFrame(req.Message.buf.Bytes())
+		if compressionFromFlags(header.Flags) != CompressionZlib {
+			t.Errorf("expected zlib flag, got %#x", header.Flags)
+		}
+
+		plain, _ := NewProducer().NewRequest(1, NewPayload(1, 42, []byte("origin"), data), context.Background())
+		if plain.Message.IsFramed() {
+			t.Errorf("expected producer without options to leave messages unframed")
+		}
+	})
+
+	t.Run("test parsing names", func(t *testing.T) {
+		if c, err := ParseCompression("lzw"); err != nil || c != CompressionLZW {
+			t.Errorf("expected lzw, got %v %v", c, err)
+		}
+		if _, err := ParseCompression("brotli"); !errors.Is(err, ErrUnknownCompression) {
+			t.Errorf("expected ErrUnknownCompression, got %v", err)
+		}
+	})
+}
+
+func BenchmarkCompression(b *testing.B) {
+	data := bytes.Repeat([]byte("Helsinki;15.0,London;16.2,Lisbon;22.3,"), 25000)
+	payload := NewPayload(1, 42, []byte("origin"), data)
+	for _, c := range []Compression{CompressionNone, CompressionFlate, CompressionGzip, CompressionZlib, CompressionLZW} {
+		b.Run(c.String(), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			s := NewSerialisable(WithCompression(c, 0))
+			for i := 0; i < b.N; i++ {
+				if err := s.EncodePayload(payload); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(s.buf.Len()), "bytes/msg")
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// encoding of a payload inside a frame, stored in the content byte of the frame header.
+// Unframed messages are always ContentBinary.
+type ContentType uint8
+
+const (
+	ContentBinary      ContentType = iota // little-endian layout of the codec registry
+	ContentJSON                           // Payload.MarshalToJson form
+	ContentMessagePack                    // map with the keys of the JSON form
+)
+
+func (c ContentType) String() string {
+	switch c {
+	case ContentBinary:
+		return "binary"
+	case ContentJSON:
+		return "json"
+	case ContentMessagePack:
+		return "msgpack"
+	}
+	return fmt.Sprintf("content(%d)", uint8(c))
+}
+
+// get a content type from its name
+func ParseContentType(name string) (ContentType, error) {
+	for c := ContentBinary; c <= ContentMessagePack; c++ {
+		if c.String() == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownContentType, name)
+}
+
+// Encodes whole payloads in one content type. Compression and encryption are applied to
+// the Data field before a payload reaches the codec.
+type ContentCodec interface {
+	ContentType() ContentType
+	AppendPayload(dst []byte, payload *Payload) ([]byte, error) // append the encoded payload to dst
+	DecodePayload(data []byte, payload *Payload) error          // decode data into payload, copying what it keeps
+}
+
+var (
+	contentCodecsLock sync.RWMutex
+	contentCodecs     = make(map[ContentType]ContentCodec)
+)
+
+func init() {
+	RegisterContentCodec(BinaryContent{})
+	RegisterContentCodec(JSONContent{})
+	RegisterContentCodec(MessagePackContent{})
+}
+
+// registers a content codec for its content type, replaces any existing registration
+func RegisterContentCodec(codec ContentCodec) {
+	contentCodecsLock.Lock()
+	defer contentCodecsLock.Unlock()
+	contentCodecs[codec.ContentType()] = codec
+}
+
+// get the registered codec for a content type
+func LookupContentCodec(content ContentType) (ContentCodec, error) {
+	contentCodecsLock.RLock()
+	defer contentCodecsLock.RUnlock()
+	codec, ok := contentCodecs[content]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownContentType, uint8(content))
+	}
+	return codec, nil
+}
+
+// encode payloads as the content type instead of the binary layout, the content type is
+// recorded in the frame header so this implies WithFraming
+func WithContentType(content ContentType) SerialisableOpt {
+	return func(s *Serialisable) {
+		s.framed = true
+		s.content = content
+	}
+}
+
+// the native binary layout, see Payload.AppendBinary. Serialisables use their codec
+// registry for binary content so older layouts keep working.
+type BinaryContent struct{}
+
+func (BinaryContent) ContentType() ContentType {
+	return ContentBinary
+}
+
+func (BinaryContent) AppendPayload(dst []byte, payload *Payload) ([]byte, error) {
+	return payload.AppendBinary(dst)
+}
+
+func (BinaryContent) DecodePayload(data []byte, payload *Payload) error {
+	return payload.UnmarshalBinary(data)
+}
+
+// the JSON form of MarshalToJson, byte fields are base64 strings
+type JSONContent struct{}
+
+func (JSONContent) ContentType() ContentType {
+	return ContentJSON
+}
+
+func (JSONContent) AppendPayload(dst []byte, payload *Payload) ([]byte, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, encoded...), nil
+}
+
+func (JSONContent) DecodePayload(data []byte, payload *Payload) error {
+	*payload = Payload{}
+	if err := json.Unmarshal(data, payload); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadContent, err)
+	}
+	return nil
+}
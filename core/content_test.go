@@ -0,0 +1,178 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContentTypes(t *testing.T) {
+	newPayload := func() *Payload {
+		return newTestPayload(strings.Repeat("a,b,c\n", 300), "content-type", "text/csv", "route", "eu")
+	}
+	keys := StaticKeys{42: bytes.Repeat([]byte{1}, 32)}
+
+	for _, content := range []ContentType{ContentBinary, ContentJSON, ContentMessagePack} {
+		t.Run("test "+content.String()+" round trip", func(t *testing.T) {
+			optSets := map[string][]SerialisableOpt{
+				"plain":      {WithContentType(content)},
+				"compressed": {WithContentType(content), WithCompression(CompressionZlib, DefaultCompressionThreshold)},
+				"encrypted":  {WithContentType(content), WithEncryption(keys)},
+			}
+			for name, opts := range optSets {
+				s := NewSerialisable(opts...)
+				if err := s.EncodePayload(newPayload()); err != nil {
+					t.Fatalf("%s: encoding failed: %v", name, err)
+				}
+				header, _, err := s.body()
+				if err != nil || header.ContentType != content {
+					t.Errorf("%s: expected content type %v in the frame, got %v (%v)", name, content, header.ContentType, err)
+				}
+				got, err := s.DecodePayload()
+				if err != nil {
+					t.Fatalf("%s: decoding failed: %v", name, err)
+				}
+				if !reflect.DeepEqual(got, newPayload()) {
+					t.Errorf("%s: payload mismatch: got %v", name, got)
+				}
+			}
+
+			// older versions are upgraded whatever the content type
+			s := NewSerialisable(WithContentType(content))
+			s.EncodePayload(NewPayload(1, 42, []byte("origin"), []byte("v1")))
+			got, err := s.DecodePayload()
+			if err != nil || got.Version != CurrentPayloadVersion {
+				t.Errorf("expected upgraded payload, got %v (%v)", got, err)
+			}
+		})
+	}
+
+	t.Run("test json is the MarshalToJson form", func(t *testing.T) {
+		s := NewSerialisable(WithContentType(ContentJSON))
+		s.EncodePayload(newPayload())
+		_, body, _ := s.body()
+		var got Payload
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("body is not json: %v", err)
+		}
+		got2 := Payload{}
+		got2.UnmarshalJson(newPayload().MarshalToJson())
+		if !reflect.DeepEqual(got, got2) {
+			t.Errorf("json mismatch: got %v, want %v", got, got2)
+		}
+	})
+
+	t.Run("test unknown content type", func(t *testing.T) {
+		s := NewSerialisable(WithFraming())
+		s.InsertDataToSerialisableBuffer(AppendContentFrame(nil, 0, 9, []byte("{}")))
+		if _, err := s.DecodePayload(); !errors.Is(err, ErrUnknownContentType) {
+			t.Errorf("expected ErrUnknownContentType, got %v", err)
+		}
+		if err := NewSerialisable(WithContentType(9)).EncodePayload(newPayload()); !errors.Is(err, ErrUnknownContentType) {
+			t.Errorf("expected ErrUnknownContentType when encoding, got %v", err)
+		}
+		if _, err := ParseContentType("xml"); !errors.Is(err, ErrUnknownContentType) {
+			t.Errorf("expected ErrUnknownContentType when parsing, got %v", err)
+		}
+	})
+
+	t.Run("test malformed json", func(t *testing.T) {
+		s := NewSerialisable(WithFraming())
+		s.InsertDataToSerialisableBuffer(AppendContentFrame(nil, 0, ContentJSON, []byte(`{"version": "two"}`)))
+		if _, err := s.DecodePayload(); !errors.Is(err, ErrBadContent) {
+			t.Errorf("expected ErrBadContent, got %v", err)
+		}
+	})
+
+	t.Run("test version 1 json with headers", func(t *testing.T) {
+		s := NewSerialisable(WithContentType(ContentJSON))
+		s.EncodePayload(newPayload())
+		_, body, _ := s.body()
+		var fields map[string]interface{}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			t.Fatalf("body is not json: %v", err)
+		}
+		fields["version"] = 1
+		body, _ = json.Marshal(fields)
+
+		old := NewSerialisable(WithFraming())
+		old.InsertDataToSerialisableBuffer(AppendContentFrame(nil, 0, ContentJSON, body))
+		if _, err := old.DecodePayload(); !errors.Is(err, ErrHeadersUnsupported) {
+			t.Errorf("expected ErrHeadersUnsupported, got %v", err)
+		}
+	})
+}
+
+func TestMessagePack(t *testing.T) {
+	codec := MessagePackContent{}
+	str := func(s string) []byte { return append([]byte{0xa0 | uint8(len(s))}, s...) }
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	t.Run("test encoding", func(t *testing.T) {
+		got, err := codec.AppendPayload(nil, NewPayload(2, 42, []byte("id"), []byte("hi")))
+		if err != nil {
+			t.Fatalf("encoding failed: %v", err)
+		}
+		want := join(
+			[]byte{0x84},
+			str("version"), []byte{0x02},
+			str("clientId"), []byte{0x2a},
+			str("identifier"), []byte{0xc4, 2, 'i', 'd'},
+			str("data"), []byte{0xc4, 2, 'h', 'i'},
+		)
+		if !bytes.Equal(got, want) {
+			t.Errorf("encoding mismatch:\ngot  %x\nwant %x", got, want)
+		}
+	})
+
+	t.Run("test decoding other encoders", func(t *testing.T) {
+		// wide integers, str instead of bin, nil identifier and unknown keys with nested values
+		encoded := join(
+			[]byte{0x86},
+			str("trace"), []byte{0x92, 0x81}, str("span"), []byte{0xcb, 0, 0, 0, 0, 0, 0, 0, 0, 0xc3},
+			str("clientId"), []byte{0xd1, 0x01, 0x00},
+			str("version"), []byte{0xcf, 0, 0, 0, 0, 0, 0, 0, 2},
+			str("identifier"), []byte{0xc0},
+			str("data"), []byte{0xd9, 2, 'h', 'i'},
+			str("headers"), []byte{0x91, 0x82}, str("key"), str("route"), str("value"), str("eu"),
+		)
+		var got Payload
+		if err := codec.DecodePayload(encoded, &got); err != nil {
+			t.Fatalf("decoding failed: %v", err)
+		}
+		want := Payload{Version: 2, ClientId: 256, Data: []byte("hi"), Headers: Headers{{"route", "eu"}}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("payload mismatch: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("test decoding errors", func(t *testing.T) {
+		encoded, _ := codec.AppendPayload(nil, &Payload{Version: 2, ClientId: 42, Data: []byte("hi"), Headers: Headers{{"k", "v"}}})
+		for n := 0; n < len(encoded); n++ {
+			if err := codec.DecodePayload(encoded[:n], new(Payload)); !errors.Is(err, ErrTruncated) {
+				t.Errorf("%d bytes: expected ErrTruncated, got %v", n, err)
+			}
+		}
+
+		cases := map[string]struct {
+			encoded []byte
+			want    error
+		}{
+			"negative version": {join([]byte{0x81}, str("version"), []byte{0xff}), ErrTypeMismatch},
+			"version overflow": {join([]byte{0x81}, str("version"), []byte{0xce, 0, 1, 0, 0}), ErrTypeMismatch},
+			"bool data":        {join([]byte{0x81}, str("data"), []byte{0xc3}), ErrTypeMismatch},
+			"not a map":        {[]byte{0x90}, ErrTypeMismatch},
+			"invalid format":   {join([]byte{0x81}, str("x"), []byte{0xc1}), ErrBadContent},
+			"trailing bytes":   {[]byte{0x80, 0x00}, ErrBadContent},
+			"deep nesting":     {join([]byte{0x81}, str("x"), bytes.Repeat([]byte{0x91}, 100), []byte{0x00}), ErrBadContent},
+		}
+		for name, tc := range cases {
+			if err := codec.DecodePayload(tc.encoded, new(Payload)); !errors.Is(err, tc.want) {
+				t.Errorf("%s: expected %v, got %v", name, tc.want, err)
+			}
+		}
+	})
+}
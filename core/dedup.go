@@ -0,0 +1,142 @@
+package core
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// number of (ClientId, Identifier) pairs a Deduplicator remembers by default
+const DefaultDedupCapacity = 100000
+
+type dedupKey struct {
+	clientId   uint16
+	identifier string
+}
+
+type dedupEntry struct {
+	key  dedupKey
+	seen time.Time // when the pair was first seen
+}
+
+// dispatcher stage that rejects requests with ErrDuplicate when their (ClientId, Identifier)
+// pair was seen recently, such as batches a producer broadcast again after a timeout. Pairs
+// are forgotten once the window has passed since they were first seen, so a producer that keeps
+// sending a pair gets through once a window, or once capacity newer pairs push them out. The
+// dispatcher reverts the pair of a request that fails, so the producer can publish it again.
+// Every dispatcher needs its own Deduplicator.
+type Deduplicator struct {
+	sync.Mutex
+	window   time.Duration // zero remembers pairs until they are pushed out
+	capacity int
+	entries  map[dedupKey]*list.Element
+	order    *list.List       // entries, most recently first seen first
+	now      func() time.Time // clock, replaced in tests
+}
+
+type DeduplicatorOpt func(*Deduplicator)
+
+// forget pairs window after they were first seen
+func WithDedupWindow(window time.Duration) DeduplicatorOpt {
+	return func(d *Deduplicator) {
+		d.window = window
+	}
+}
+
+// remember at most capacity pairs
+func WithDedupCapacity(capacity int) DeduplicatorOpt {
+	return func(d *Deduplicator) {
+		d.capacity = capacity
+	}
+}
+
+// creates a Deduplicator with options, it remembers DefaultDedupCapacity pairs for ever by default
+func NewDeduplicator(opts ...DeduplicatorOpt) *Deduplicator {
+	d := &Deduplicator{
+		capacity: DefaultDedupCapacity,
+		entries:  make(map[dedupKey]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.capacity < 1 {
+		d.capacity = 1
+	}
+	return d
+}
+
+// Admit implements Stage. The payload is peeked so encrypted requests can be checked without their keys.
+func (d *Deduplicator) Admit(req *Request) error {
+	payload, err := req.Message.PeekPayload()
+	if err != nil {
+		return err
+	}
+	if d.Seen(payload.ClientId, payload.Identifier) {
+		return fmt.Errorf("%w: client %d identifier %q", ErrDuplicate, payload.ClientId, payload.Identifier)
+	}
+	return nil
+}
+
+// Revert implements RevertibleStage, it forgets the pair of a request that was not processed
+func (d *Deduplicator) Revert(req *Request) {
+	payload, err := req.Message.PeekPayload()
+	if err != nil {
+		return
+	}
+	d.Forget(payload.ClientId, payload.Identifier)
+}
+
+// record the pair and report whether it was seen within the window. Seeing a pair again does
+// not extend its window.
+func (d *Deduplicator) Seen(clientId uint16, identifier []byte) bool {
+	now := d.now()
+	d.Lock()
+	defer d.Unlock()
+	d.prune(now)
+	if _, ok := d.entries[dedupKey{clientId, string(identifier)}]; ok {
+		return true
+	}
+	key := dedupKey{clientId, string(identifier)}
+	d.entries[key] = d.order.PushFront(&dedupEntry{key, now})
+	if d.order.Len() > d.capacity {
+		d.remove(d.order.Back())
+	}
+	return false
+}
+
+// forget the pair, so it is not a duplicate the next time it is seen
+func (d *Deduplicator) Forget(clientId uint16, identifier []byte) {
+	d.Lock()
+	defer d.Unlock()
+	if elem, ok := d.entries[dedupKey{clientId, string(identifier)}]; ok {
+		d.remove(elem)
+	}
+}
+
+// number of pairs remembered
+func (d *Deduplicator) Len() int {
+	d.Lock()
+	defer d.Unlock()
+	return d.order.Len()
+}
+
+// forget the pairs first seen longer than the window ago, the oldest are at the back
+func (d *Deduplicator) prune(now time.Time) {
+	if d.window <= 0 {
+		return
+	}
+	for oldest := d.order.Back(); oldest != nil; oldest = d.order.Back() {
+		if now.Sub(oldest.Value.(*dedupEntry).seen) < d.window {
+			return
+		}
+		d.remove(oldest)
+	}
+}
+
+func (d *Deduplicator) remove(elem *list.Element) {
+	delete(d.entries, elem.Value.(*dedupEntry).key)
+	d.order.Remove(elem)
+}
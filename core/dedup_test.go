@@ -0,0 +1,165 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeduplicator(t *testing.T) {
+	t.Run("test pairs are remembered for the window", func(t *testing.T) {
+		now := time.Unix(0, 0)
+		d := NewDeduplicator(WithDedupWindow(time.Minute))
+		d.now = func() time.Time { return now }
+
+		if d.Seen(1, []byte("batch-1")) {
+			t.Error("expected the first sighting not to be a duplicate")
+		}
+		if !d.Seen(1, []byte("batch-1")) {
+			t.Error("expected the second sighting to be a duplicate")
+		}
+		if d.Seen(2, []byte("batch-1")) || d.Seen(1, []byte("batch-2")) {
+			t.Error("expected pairs to be keyed on both client and identifier")
+		}
+
+		// sightings do not extend the window, so a producer that keeps sending gets through
+		now = now.Add(50 * time.Second)
+		if !d.Seen(1, []byte("batch-1")) {
+			t.Error("expected a duplicate within the window")
+		}
+		now = now.Add(10 * time.Second)
+		if d.Seen(1, []byte("batch-1")) {
+			t.Error("expected the pair to be forgotten a window after it was first seen")
+		}
+		if d.Len() != 1 {
+			t.Errorf("expected pairs first seen before the window to be forgotten, %d left", d.Len())
+		}
+
+		d.Forget(1, []byte("batch-1"))
+		if d.Seen(1, []byte("batch-1")) {
+			t.Error("expected a forgotten pair not to be a duplicate")
+		}
+	})
+
+	t.Run("test oldest pairs are pushed out", func(t *testing.T) {
+		d := NewDeduplicator(WithDedupCapacity(2))
+		d.Seen(1, []byte("a"))
+		d.Seen(1, []byte("b"))
+		d.Seen(1, []byte("a"))
+		d.Seen(1, []byte("c"))
+		if d.Len() != 2 {
+			t.Errorf("expected 2 pairs, got %d", d.Len())
+		}
+		if !d.Seen(1, []byte("b")) {
+			t.Error("expected the newer pair to be kept")
+		}
+		if d.Seen(1, []byte("a")) {
+			t.Error("expected the pair first seen longest ago to be pushed out")
+		}
+	})
+
+	t.Run("test admit rejects duplicates", func(t *testing.T) {
+		d := NewDeduplicator()
+		payload := NewPayload(CurrentPayloadVersion, 1, []byte("batch-1"), []byte("data"))
+		if err := d.Admit(createAndFormatTestRequest(payload, 1, context.Background())); err != nil {
+			t.Fatalf("expected the first request to be admitted: %v", err)
+		}
+		if err := d.Admit(createAndFormatTestRequest(payload, 2, context.Background())); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("expected ErrDuplicate, got %v", err)
+		}
+	})
+}
+
+func TestDispatcherDropsDuplicates(t *testing.T) {
+	ctx := context.Background()
+	producer := NewProducer()
+	var requests []*Request
+	for i, identifier := range []string{"batch-1", "batch-2", "batch-1"} {
+		req, err := producer.NewRequest(i, NewPayload(CurrentPayloadVersion, 1, []byte(identifier), []byte("data")), ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		requests = append(requests, req)
+	}
+
+	var processed atomic.Int32
+	recorder := processorFunc(func(*Request) error {
+		processed.Add(1)
+		return nil
+	})
+
+	quarantine := make(RequestQueue, len(requests))
+	dispatcher := NewDispatcher(1, 1)
+	dispatcher.AddQueue(make(RequestQueue, len(requests)))
+	dispatcher.AddStage(NewDeduplicator(WithDedupWindow(time.Minute)))
+	dispatcher.AddQuarantine(quarantine)
+	dispatcher.Run(recorder)
+	producer.Subscribe(dispatcher)
+
+	for i, want := range []error{nil, nil, ErrDuplicate} {
+		if _, err := waitFuture(t, producer.Publish(ctx, requests[i])); !errors.Is(err, want) {
+			t.Errorf("expected request %d to end with %v, got %v", i, want, err)
+		}
+	}
+	if got := processed.Load(); got != 2 {
+		t.Errorf("expected every batch to be processed once, got %d processed", got)
+	}
+	if got := dispatcher.Stats().Rejected; got != 0 {
+		t.Errorf("expected no rejections, got %d", got)
+	}
+	if len(quarantine) != 0 {
+		t.Errorf("expected duplicates not to be quarantined, got %d", len(quarantine))
+	}
+}
+
+func TestDedupFailedRequests(t *testing.T) {
+	failure := errors.New("processing failed")
+	var fail atomic.Bool
+	var processed atomic.Int32
+	producer := NewProducer(WithoutResultPayloads())
+	deadLetter := make(RequestQueue, 1)
+	dispatcher := NewDispatcher(1, 1)
+	dispatcher.AddQueue(make(RequestQueue, 1))
+	dispatcher.AddStage(NewDeduplicator(WithDedupWindow(time.Minute)))
+	dispatcher.AddDeadLetterQueue(deadLetter)
+	dispatcher.Run(processorFunc(func(*Request) error {
+		if fail.Load() {
+			return failure
+		}
+		processed.Add(1)
+		return nil
+	}))
+	producer.Subscribe(dispatcher)
+	publish := func() error {
+		req, _ := producer.NewRequest(1, NewPayload(CurrentPayloadVersion, 1, []byte("batch-1"), []byte("data")), context.Background())
+		_, err := waitFuture(t, producer.Publish(context.Background(), req))
+		return err
+	}
+
+	fail.Store(true)
+	if err := publish(); !errors.Is(err, failure) {
+		t.Fatalf("expected the first attempt to fail, got %v", err)
+	}
+	failed := <-deadLetter
+
+	// the failed request was forgotten, so publishing it again is not a duplicate
+	fail.Store(false)
+	if err := publish(); err != nil {
+		t.Errorf("expected the request published again to be processed, got %v", err)
+	}
+	if err := publish(); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected a processed request to be a duplicate, got %v", err)
+	}
+
+	// replays pass the stages again, so the dead letter is not processed twice
+	dispatcher.Replay(failed)
+	deadline := time.Now().Add(time.Second)
+	for dispatcher.Stats().Duplicates < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := dispatcher.Stats(); stats.Duplicates != 2 || processed.Load() != 1 {
+		t.Errorf("expected the replay to be dropped as a duplicate, %d processed, got %+v", processed.Load(), stats)
+	}
+}
@@ -1,8 +1,45 @@
 package core
 
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
 // single queue message broker, to be expanded
 type RequestQueue chan *Request
 
+// inspects a request before it is handed to a worker, an error keeps the request from being processed
+type Stage interface {
+	Admit(*Request) error
+}
+
+// stage that records admitted requests, such as a Deduplicator. Revert undoes what Admit
+// recorded for a request that was not processed.
+type RevertibleStage interface {
+	Stage
+	Revert(*Request)
+}
+
+// adapter to use a function as a Stage
+type StageFunc func(*Request) error
+
+func (fn StageFunc) Admit(req *Request) error {
+	return fn(req)
+}
+
+// counters of a dispatcher
+type DispatcherStats struct {
+	Rejected        uint64 // requests that failed a stage
+	DecryptFailures uint64 // rejected requests that could not be decrypted
+	Expired         uint64 // requests dropped because their TTL ran out
+	Duplicates      uint64 // requests dropped by a Deduplicator, not counted as rejected
+	Retries         uint64 // failed attempts that were retried
+	DeadLettered    uint64 // requests given up on after failing
+}
+
 // dispatches requests to available workers - interface with workers
 type Dispatcher struct {
 	id         uint64
@@ -10,6 +47,20 @@ type Dispatcher struct {
 	maxWorkers int                // maxWorker count
 	queue      RequestQueue       // where the dispatcher will get the requests from
 	quit       chan bool          // bool to stop the dispatcher
+	stages     []Stage            // checks every request has to pass before it reaches a worker
+	quarantine RequestQueue       // where rejected requests are sent, dropped when nil
+	expirySink RequestQueue       // where expired requests are sent, dropped when nil
+	priority   *PriorityQueue     // orders admitted requests for the workers, in arrival order when nil
+	retry      *RetryPolicy       // retries requests the processor fails on, never when nil
+	deadLetter RequestQueue       // where requests that failed on their last attempt are sent, dropped when nil
+	middleware []Middleware       // wraps the processor passed to Run
+
+	rejected        atomic.Uint64
+	decryptFailures atomic.Uint64
+	expired         atomic.Uint64
+	duplicates      atomic.Uint64
+	retries         atomic.Uint64
+	deadLettered    atomic.Uint64
 }
 
 // creates NewDispatcher
@@ -23,10 +74,66 @@ func (d *Dispatcher) AddQueue(queue RequestQueue) {
 	d.queue = queue
 }
 
+// add a stage that requests have to pass before processing, stages run in the order they were added
+func (d *Dispatcher) AddStage(stage Stage) {
+	d.stages = append(d.stages, stage)
+}
+
+// send requests rejected by a stage to queue instead of dropping them
+func (d *Dispatcher) AddQuarantine(queue RequestQueue) {
+	d.quarantine = queue
+}
+
+// send requests that expire before they are processed to queue instead of dropping them
+func (d *Dispatcher) AddExpirySink(queue RequestQueue) {
+	d.expirySink = queue
+}
+
+// hand admitted requests to workers in the order of the priority queue instead of the order
+// they arrive in, the queue must not be shared with other dispatchers
+func (d *Dispatcher) AddPriorityQueue(queue *PriorityQueue) {
+	d.priority = queue
+}
+
+// retry requests the processor fails on with the policy
+func (d *Dispatcher) AddRetryPolicy(policy *RetryPolicy) {
+	d.retry = policy
+}
+
+// send requests that fail on their last attempt to queue instead of dropping them, with their
+// Failure and Attempts. Replay them once the cause is fixed.
+func (d *Dispatcher) AddDeadLetterQueue(queue RequestQueue) {
+	d.deadLetter = queue
+}
+
+// wrap the processor passed to Run with middleware, in the order of Chain. Middleware of earlier
+// calls is outermost.
+func (d *Dispatcher) Use(middleware ...Middleware) {
+	d.middleware = append(d.middleware, middleware...)
+}
+
+// snapshot of the dispatcher counters
+func (d *Dispatcher) Stats() DispatcherStats {
+	return DispatcherStats{
+		Rejected:        d.rejected.Load(),
+		DecryptFailures: d.decryptFailures.Load(),
+		Expired:         d.expired.Load(),
+		Duplicates:      d.duplicates.Load(),
+		Retries:         d.retries.Load(),
+		DeadLettered:    d.deadLettered.Load(),
+	}
+}
+
 // starting n number of workers
 func (d *Dispatcher) Run(p DataProcessor) {
+	p = Chain(p, d.middleware...)
 	for i := 0; i < d.maxWorkers; i++ {
 		worker := NewWorker(d.WorkerPool)
+		worker.expire = d.expire
+		worker.failed = d.retryOrDeadLetter
+		worker.revert = d.revert
+		// workers take the next request only once they are done, so the priority queue decides the order
+		worker.serial = d.priority != nil
 		worker.Start(i, p)
 	}
 
@@ -35,13 +142,23 @@ func (d *Dispatcher) Run(p DataProcessor) {
 
 // goroutine to dispatch requests to workers
 func (d *Dispatcher) dispatch() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if d.priority != nil {
+		go d.dispatchByPriority(ctx)
+	}
 	for {
 		select {
 		case req := <-d.queue:
 			go func(req *Request) {
-				requestChannel := <-d.WorkerPool
-
-				requestChannel <- req
+				if req.Expired(time.Now()) {
+					d.expire(req)
+					return
+				}
+				if !d.admit(req) {
+					return
+				}
+				d.handOff(req)
 			}(req)
 		case <-d.quit:
 			return
@@ -49,6 +166,179 @@ func (d *Dispatcher) dispatch() {
 	}
 }
 
+// hand an admitted request to a worker, through the priority queue when there is one
+func (d *Dispatcher) handOff(req *Request) {
+	if d.priority != nil {
+		d.priority.Push(req)
+		return
+	}
+	requestChannel := <-d.WorkerPool
+
+	requestChannel <- req
+}
+
+// hand the most urgent request of the priority queue to every worker that becomes available
+func (d *Dispatcher) dispatchByPriority(ctx context.Context) {
+	for {
+		var requestChannel chan *Request
+		select {
+		case requestChannel = <-d.WorkerPool:
+		case <-ctx.Done():
+			return
+		}
+		req, err := d.priority.Pop(ctx)
+		if err != nil {
+			return
+		}
+		requestChannel <- req
+	}
+}
+
+// run the stages for a request, rejected requests are quarantined and duplicates dropped
+func (d *Dispatcher) admit(req *Request) bool {
+	for i, stage := range d.stages {
+		if err := stage.Admit(req); err != nil {
+			revertStages(d.stages[:i], req)
+			d.reject(req, err)
+			return false
+		}
+	}
+	req.admitted = true
+	return true
+}
+
+// undo what the stages recorded for a request that was admitted but not processed
+func (d *Dispatcher) revert(req *Request) {
+	if req.admitted {
+		req.admitted = false
+		revertStages(d.stages, req)
+	}
+}
+
+func revertStages(stages []Stage, req *Request) {
+	for _, stage := range stages {
+		if revertible, ok := stage.(RevertibleStage); ok {
+			revertible.Revert(req)
+		}
+	}
+}
+
+func (d *Dispatcher) reject(req *Request, err error) {
+	// duplicates were already processed, they are dropped instead of being quarantined
+	req.fail(err)
+	if errors.Is(err, ErrDuplicate) {
+		d.duplicates.Add(1)
+		log.Printf("Dispatcher %d: Request %d dropped: %v", d.id, req.Id, err)
+		req.Release()
+		return
+	}
+	d.rejected.Add(1)
+	var decryptErr *DecryptError
+	if errors.As(err, &decryptErr) {
+		d.decryptFailures.Add(1)
+	}
+	log.Printf("Dispatcher %d: Request %d rejected: %v", d.id, req.Id, err)
+	if d.quarantine == nil {
+		req.Release()
+		return
+	}
+	select {
+	case d.quarantine <- req:
+	default:
+		log.Printf("Dispatcher %d: quarantine full, dropping request %d", d.id, req.Id)
+		req.Release()
+	}
+}
+
+// count an expired request and send it to the expiry sink
+func (d *Dispatcher) expire(req *Request) {
+	d.revert(req)
+	d.expired.Add(1)
+	log.Printf("Dispatcher %d: Request %d expired", d.id, req.Id)
+	req.fail(ErrExpired)
+	if d.expirySink == nil {
+		req.Release()
+		return
+	}
+	select {
+	case d.expirySink <- req:
+	default:
+		log.Printf("Dispatcher %d: expiry sink full, dropping request %d", d.id, req.Id)
+		req.Release()
+	}
+}
+
+// record a failed attempt and retry the request after the backoff of the retry policy, or send
+// it to the dead letter queue when it should not be retried. Expired requests go to the expiry
+// sink instead. False leaves the request to the worker, when the dispatcher neither retries nor
+// dead-letters it, such as when it was cancelled.
+func (d *Dispatcher) retryOrDeadLetter(req *Request, err error) bool {
+	if d.retry == nil && d.deadLetter == nil {
+		return false
+	}
+	// cancelled and expired requests would only fail again when retried or replayed
+	if errors.Is(err, ErrExpired) {
+		d.expire(req)
+		return true
+	}
+	if errors.Is(err, context.Canceled) || req.Ctx != nil && req.Ctx.Err() != nil {
+		return false
+	}
+	req.attempts = append(req.attempts, Attempt{At: time.Now(), Err: err})
+	reason := err
+	if d.retry != nil {
+		if reason = d.retry.giveUp(err, len(req.attempts)); reason == nil {
+			d.retries.Add(1)
+			delay := d.retry.Backoff(len(req.attempts))
+			log.Printf("Dispatcher %d: Request %d retried in %v", d.id, req.Id, delay)
+			time.AfterFunc(delay, func() { d.handOff(req) })
+			return true
+		}
+	}
+	d.revert(req)
+	d.deadLettered.Add(1)
+	req.failure = reason
+	log.Printf("Dispatcher %d: Request %d dead-lettered: %v", d.id, req.Id, reason)
+	req.fail(reason)
+	if d.deadLetter == nil {
+		req.Release()
+		return true
+	}
+	select {
+	case d.deadLetter <- req:
+	default:
+		log.Printf("Dispatcher %d: dead letter queue full, dropping request %d", d.id, req.Id)
+		req.Release()
+	}
+	return true
+}
+
+// hand a dead-lettered request to the workers again with no failed attempts. It passes the
+// stages again, so it is dropped as a duplicate when it was published again and processed.
+func (d *Dispatcher) Replay(req *Request) {
+	req.attempts = nil
+	req.failure = nil
+	go func() {
+		if d.admit(req) {
+			d.handOff(req)
+		}
+	}()
+}
+
+// replay every request waiting in the dead letter queue, returns how many were replayed
+func (d *Dispatcher) ReplayDeadLetters() int {
+	replayed := 0
+	for {
+		select {
+		case req := <-d.deadLetter:
+			d.Replay(req)
+			replayed++
+		default:
+			return replayed
+		}
+	}
+}
+
 func (d *Dispatcher) Stop() {
 	go func() {
 		d.quit <- true
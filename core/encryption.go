@@ -0,0 +1,117 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+)
+
+const flagEncrypted uint8 = 0x08 // frame flag bit set when the Data field is encrypted
+
+// looks up the AES key of a client, keys must be 16, 24 or 32 bytes long
+type KeyProvider interface {
+	Key(clientId uint16) ([]byte, error)
+}
+
+// adapter to use a function as a KeyProvider
+type KeyProviderFunc func(clientId uint16) ([]byte, error)
+
+func (fn KeyProviderFunc) Key(clientId uint16) ([]byte, error) {
+	return fn(clientId)
+}
+
+// fixed set of keys by client id
+type StaticKeys map[uint16][]byte
+
+func (k StaticKeys) Key(clientId uint16) ([]byte, error) {
+	key, ok := k[clientId]
+	if !ok {
+		return nil, fmt.Errorf("%w: client %d", ErrNoEncryptionKey, clientId)
+	}
+	return key, nil
+}
+
+// returned when the Data of an encrypted payload cannot be decrypted
+type DecryptError struct {
+	ClientId uint16
+	Err      error
+}
+
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("decrypting payload of client %d: %v", e.ClientId, e.Err)
+}
+
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+// encrypt the Data field of the payload with AES-GCM under the key of its client, the
+// nonce is prepended to the ciphertext. Returns a copy so the caller's payload is left alone.
+func encryptPayload(payload *Payload, keys KeyProvider) (*Payload, uint8, error) {
+	if keys == nil {
+		return payload, 0, nil
+	}
+	aead, err := payloadCipher(keys, payload.ClientId)
+	if err != nil {
+		return nil, 0, err
+	}
+	sealed := make([]byte, aead.NonceSize(), aead.NonceSize()+len(payload.Data)+aead.Overhead())
+	if _, err := rand.Read(sealed); err != nil {
+		return nil, 0, err
+	}
+	copied := *payload
+	copied.Data = aead.Seal(sealed, sealed, payload.Data, payloadAAD(payload))
+	return &copied, flagEncrypted, nil
+}
+
+// decrypt the Data field of a payload written by encryptPayload
+func decryptPayload(payload *Payload, keys KeyProvider) error {
+	if keys == nil {
+		return &DecryptError{payload.ClientId, ErrNoEncryptionKey}
+	}
+	aead, err := payloadCipher(keys, payload.ClientId)
+	if err != nil {
+		return &DecryptError{payload.ClientId, err}
+	}
+	if len(payload.Data) < aead.NonceSize() {
+		return &DecryptError{payload.ClientId, fmt.Errorf("%w: missing nonce", ErrTruncated)}
+	}
+	nonce, sealed := payload.Data[:aead.NonceSize()], payload.Data[aead.NonceSize():]
+	data, err := aead.Open(nil, nonce, sealed, payloadAAD(payload))
+	if err != nil {
+		return &DecryptError{payload.ClientId, err}
+	}
+	payload.Data = data
+	return nil
+}
+
+func payloadCipher(keys KeyProvider, clientId uint16) (cipher.AEAD, error) {
+	key, err := keys.Key(clientId)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// the client id and identifier are authenticated so ciphertext cannot be moved to another payload
+func payloadAAD(payload *Payload) []byte {
+	aad := binary.LittleEndian.AppendUint16(nil, payload.ClientId)
+	return append(aad, payload.Identifier...)
+}
+
+// dispatcher stage that decrypts requests with the given keys before they reach a worker.
+// The keys stay attached to the message so processors see plaintext from DecodePayload and
+// EncodePayload encrypts again.
+func DecryptPayloads(keys KeyProvider) Stage {
+	return StageFunc(func(req *Request) error {
+		req.Message.keys = keys
+		_, err := req.Message.DecodePayload()
+		return err
+	})
+}
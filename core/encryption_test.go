@@ -0,0 +1,157 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEncryption(t *testing.T) {
+	keys := StaticKeys{
+		42: bytes.Repeat([]byte{1}, 32),
+		7:  bytes.Repeat([]byte{2}, 16),
+	}
+	newPayload := func() *Payload {
+		return newTestPayload(strings.Repeat("secret,", 300), "content-type", "text/csv")
+	}
+
+	t.Run("test headers are read without the key", func(t *testing.T) {
+		encoder := NewSerialisable(WithEncryption(keys))
+		if err := encoder.EncodePayload(newPayload()); err != nil {
+			t.Fatalf("encoding failed: %v", err)
+		}
+		broker := NewSerialisable(WithFraming())
+		broker.InsertDataToSerialisableBuffer(encoder.buf.Bytes())
+		headers, err := NewRequest(1, broker, context.Background()).Headers()
+		if err != nil {
+			t.Fatalf("reading headers failed: %v", err)
+		}
+		if got, _ := headers.Get("content-type"); got != "text/csv" {
+			t.Errorf("expected the content-type header, got %v", headers)
+		}
+	})
+
+	t.Run("test encrypted round trip", func(t *testing.T) {
+		opts := map[string][]SerialisableOpt{
+			"plain":      {WithEncryption(keys)},
+			"compressed": {WithEncryption(keys), WithCompression(CompressionGzip, DefaultCompressionThreshold)},
+		}
+		for name, opt := range opts {
+			s := NewSerialisable(opt...)
+			if err := s.EncodePayload(newPayload()); err != nil {
+				t.Fatalf("%s: encoding failed: %v", name, err)
+			}
+			if bytes.Contains(s.buf.Bytes(), []byte("secret,")) {
+				t.Errorf("%s: plaintext found in buffer", name)
+			}
+			header, _, _ := s.body()
+			if header.Flags&flagEncrypted == 0 {
+				t.Errorf("%s: expected encrypted flag, got flags %#x", name, header.Flags)
+			}
+			got, err := s.DecodePayload()
+			if err != nil {
+				t.Fatalf("%s: decoding failed: %v", name, err)
+			}
+			if !reflect.DeepEqual(got, newPayload()) {
+				t.Errorf("%s: payload mismatch: got %v", name, got)
+			}
+		}
+	})
+
+	t.Run("test nonces are not reused", func(t *testing.T) {
+		first, second := NewSerialisable(WithEncryption(keys)), NewSerialisable(WithEncryption(keys))
+		first.EncodePayload(newPayload())
+		second.EncodePayload(newPayload())
+		if bytes.Equal(first.buf.Bytes(), second.buf.Bytes()) {
+			t.Errorf("expected different ciphertexts for the same payload")
+		}
+	})
+
+	t.Run("test decryption failures", func(t *testing.T) {
+		encrypted := func() []byte {
+			s := NewSerialisable(WithEncryption(keys))
+			s.EncodePayload(newPayload())
+			return s.buf.Bytes()
+		}
+		wrongKey := StaticKeys{42: bytes.Repeat([]byte{3}, 32)}
+		cases := map[string]*Serialisable{
+			"wrong key":    NewSerialisable(WithEncryption(wrongKey)),
+			"unknown key":  NewSerialisable(WithEncryption(StaticKeys{})),
+			"no provider":  NewSerialisable(WithFraming()),
+			"bad key size": NewSerialisable(WithEncryption(StaticKeys{42: []byte("short")})),
+		}
+		for name, s := range cases {
+			s.InsertDataToSerialisableBuffer(encrypted())
+			_, err := s.DecodePayload()
+			var decryptErr *DecryptError
+			if !errors.As(err, &decryptErr) || decryptErr.ClientId != 42 {
+				t.Errorf("%s: expected DecryptError for client 42, got %v", name, err)
+			}
+		}
+
+		// moving the ciphertext to another client fails authentication
+		s := NewSerialisable(WithEncryption(keys))
+		s.EncodePayload(newPayload())
+		_, body, _ := s.body()
+		moved := append([]byte{}, body...)
+		moved[2] = 7
+		s.InsertDataToSerialisableBuffer(AppendFrame(nil, flagEncrypted, moved))
+		if _, err := s.DecodePayload(); !errors.As(err, new(*DecryptError)) {
+			t.Errorf("expected DecryptError for moved ciphertext, got %v", err)
+		}
+	})
+}
+
+func TestDispatcherDecryptsPayloads(t *testing.T) {
+	keys := StaticKeys{1: bytes.Repeat([]byte{1}, 32), 2: bytes.Repeat([]byte{2}, 32)}
+	producer := NewProducer(WithPayloadEncryption(keys))
+	ctx := context.Background()
+	valid, err := producer.NewRequest(1, NewPayload(CurrentPayloadVersion, 1, []byte("origin"), []byte("valid")), ctx)
+	if err != nil {
+		t.Fatalf("creating request failed: %v", err)
+	}
+	undecryptable, _ := producer.NewRequest(2, NewPayload(CurrentPayloadVersion, 2, []byte("origin"), []byte("lost")), ctx)
+
+	var processed atomic.Int32
+	recorder := processorFunc(func(*Request) error {
+		processed.Add(1)
+		return nil
+	})
+
+	quarantine := make(RequestQueue, 2)
+	dispatcher := NewDispatcher(1, 1)
+	dispatcher.AddQueue(make(RequestQueue, 2))
+	dispatcher.AddStage(DecryptPayloads(StaticKeys{1: keys[1]}))
+	dispatcher.AddQuarantine(quarantine)
+	dispatcher.Run(recorder)
+	producer.Subscribe(dispatcher)
+
+	payload, err := waitFuture(t, producer.Publish(ctx, valid))
+	if err != nil || string(payload.Data) != "valid" {
+		t.Errorf("expected the processed request to be plaintext, got %v, %v", payload, err)
+	}
+	var decryptErr *DecryptError
+	if _, err := waitFuture(t, producer.Publish(ctx, undecryptable)); !errors.As(err, &decryptErr) {
+		t.Errorf("expected request 2 to fail decryption, got %v", err)
+	}
+	if got := processed.Load(); got != 1 {
+		t.Errorf("expected only request 1 to be processed, got %d", got)
+	}
+
+	select {
+	case req := <-quarantine:
+		if req.Id != 2 {
+			t.Errorf("expected request 2 to be quarantined, got %d", req.Id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected a quarantined request")
+	}
+	if stats := dispatcher.Stats(); stats.Rejected != 1 || stats.DecryptFailures != 1 {
+		t.Errorf("expected 1 rejected decryption failure, got %+v", stats)
+	}
+}
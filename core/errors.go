@@ -0,0 +1,44 @@
+package core
+
+type constError string
+
+func (err constError) Error() string {
+	return string(err)
+}
+
+const (
+	ErrUnknownVersion   = constError("no codec registered for version")
+	ErrUpgradeFailed    = constError("payload upgrade did not advance version")
+	ErrEmptyBuffer      = constError("serialisable has no buffer to decode")
+	ErrTruncated        = constError("message truncated")
+	ErrBadMagic         = constError("bad frame magic")
+	ErrUnsupportedFrame = constError("unsupported frame version")
+	ErrFrameLength      = constError("invalid frame length")
+	ErrChecksum         = constError("frame checksum mismatch")
+	ErrLengthTooLarge   = constError("length exceeds decode limit")
+	ErrUnknownField     = constError("unknown field")
+	ErrTypeMismatch     = constError("field type mismatch")
+
+	ErrHeadersUnsupported = constError("payload version does not support headers")
+	ErrTaggedUnsupported  = constError("payload version does not support tagged fields")
+	ErrBadTagged          = constError("malformed tagged fields")
+	ErrUnknownCompression = constError("unknown compression")
+	ErrNoSigningKey       = constError("key ring has no current signing key")
+	ErrUnsigned           = constError("payload is not signed")
+	ErrUnknownKey         = constError("payload signed with unknown key")
+	ErrBadSignature       = constError("payload signature mismatch")
+	ErrCorruptCompression = constError("corrupt compressed data")
+	ErrNoEncryptionKey    = constError("no encryption key for client")
+	ErrUnknownContentType = constError("unknown content type")
+	ErrBadContent         = constError("malformed content")
+	ErrBadBatch           = constError("malformed batch envelope")
+	ErrIndexOutOfRange    = constError("record index out of range")
+	ErrDuplicate          = constError("duplicate request")
+	ErrNoSubscribers      = constError("no dispatchers subscribed")
+	ErrNotDelivered       = constError("request not delivered to dispatcher")
+	ErrExpired            = constError("request expired")
+	ErrRetriesExhausted   = constError("request failed on every attempt")
+	ErrNotRetryable       = constError("request failed with an error that is not retried")
+	ErrPanic              = constError("processor panicked")
+	ErrTimeout            = constError("processing timed out")
+)
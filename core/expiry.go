@@ -0,0 +1,110 @@
+package core
+
+import (
+	"time"
+)
+
+// tagged fields assigned by gewh
+const (
+	TagTimestamp uint16 = 1 // int64 unix nanoseconds the producer created the payload at
+	TagTTL       uint16 = 2 // int64 nanoseconds the payload stays valid for after its timestamp
+)
+
+// time the producer created the payload at, zero when it has no timestamp
+func (p *Payload) Timestamp() time.Time {
+	nanos := GetTaggedValue(p.Tagged, TagTimestamp, int64(0))
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// set the creation time of the payload
+func (p *Payload) SetTimestamp(t time.Time) {
+	SetTaggedValue(p, TagTimestamp, t.UnixNano())
+}
+
+// how long the payload stays valid for after its timestamp, zero when it never expires
+func (p *Payload) TTL() time.Duration {
+	return time.Duration(GetTaggedValue(p.Tagged, TagTTL, int64(0)))
+}
+
+// set how long the payload stays valid for, zero or less removes the TTL
+func (p *Payload) SetTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		p.DelTagged(TagTTL)
+		return
+	}
+	SetTaggedValue(p, TagTTL, int64(ttl))
+}
+
+// time the payload expires at, zero when it needs both a timestamp and a TTL to expire
+func (p *Payload) Deadline() time.Time {
+	timestamp, ttl := p.Timestamp(), p.TTL()
+	if timestamp.IsZero() || ttl <= 0 {
+		return time.Time{}
+	}
+	return timestamp.Add(ttl)
+}
+
+// has the payload expired at now
+func (p *Payload) Expired(now time.Time) bool {
+	deadline := p.Deadline()
+	return !deadline.IsZero() && now.After(deadline)
+}
+
+// time the payload of the request expires at, zero when it does not expire. The payload is
+// peeked so encrypted requests can be checked without their keys, and the result is kept
+// for later calls.
+func (r *Request) Deadline() (time.Time, error) {
+	if r.deadlineKnown {
+		return r.deadline, nil
+	}
+	payload, err := r.Message.PeekPayload()
+	if err != nil {
+		return time.Time{}, err
+	}
+	r.setDeadline(payload)
+	return r.deadline, nil
+}
+
+// has the payload of the request expired at now, requests that cannot be decoded have not
+func (r *Request) Expired(now time.Time) bool {
+	deadline, err := r.Deadline()
+	return err == nil && !deadline.IsZero() && now.After(deadline)
+}
+
+func (r *Request) setDeadline(payload *Payload) {
+	r.deadline = payload.Deadline()
+	r.deadlineKnown = true
+}
+
+// payload with its creation time and the given TTL unless it already has them, built in memory
+// the request keeps so stamping does not allocate. Version 1 payloads cannot carry tagged
+// fields and are returned as they are. Call unstamp once the payload has been encoded.
+func (r *Request) stamp(payload *Payload, ttl time.Duration) *Payload {
+	if payload.Version < 2 {
+		return payload
+	}
+	stamped := &r.stamped.payload
+	tagged := stamped.Tagged
+	*stamped = *payload
+	stamped.Tagged = append(tagged[:0], payload.Tagged...)
+	values := r.stamped.values[:0]
+	if stamped.Timestamp().IsZero() {
+		values = appendTaggedValue(values, time.Now().UnixNano())
+		stamped.SetTagged(TagTimestamp, values[len(values)-8:])
+	}
+	if ttl > 0 && stamped.TTL() == 0 {
+		values = appendTaggedValue(values, int64(ttl))
+		stamped.SetTagged(TagTTL, values[len(values)-8:])
+	}
+	return stamped
+}
+
+// drop the references stamp kept to the caller's payload
+func (r *Request) unstamp() {
+	tagged := r.stamped.payload.Tagged
+	clear(tagged)
+	r.stamped.payload = Payload{Tagged: tagged[:0]}
+}
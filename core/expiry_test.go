@@ -0,0 +1,177 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExpiry(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	newPayload := func(ttl time.Duration) *Payload {
+		payload := newTestPayload("Hello, World!")
+		payload.SetTimestamp(created)
+		payload.SetTTL(ttl)
+		return payload
+	}
+
+	t.Run("test timestamp and ttl round trip", func(t *testing.T) {
+		s := NewSerialisable()
+		s.EncodePayload(newPayload(time.Minute))
+		got, err := s.DecodePayload()
+		if err != nil {
+			t.Fatalf("decoding failed: %v", err)
+		}
+		if !got.Timestamp().Equal(created) || got.TTL() != time.Minute {
+			t.Errorf("expected %v and 1m, got %v and %v", created, got.Timestamp(), got.TTL())
+		}
+		if want := created.Add(time.Minute); !got.Deadline().Equal(want) {
+			t.Errorf("expected deadline %v, got %v", want, got.Deadline())
+		}
+		if got.Expired(created.Add(time.Minute)) || !got.Expired(created.Add(time.Minute+1)) {
+			t.Errorf("expected the payload to expire just after its deadline")
+		}
+	})
+
+	t.Run("test payloads without both fields never expire", func(t *testing.T) {
+		never := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+		payload := newPayload(time.Minute)
+		payload.SetTTL(0)
+		if _, ok := payload.Tagged.Get(TagTTL); ok || payload.Expired(never) {
+			t.Errorf("expected a zero TTL to remove the tag, got %v", payload.Tagged)
+		}
+		payload = NewPayload(CurrentPayloadVersion, 42, nil, nil)
+		payload.SetTTL(time.Minute)
+		if !payload.Timestamp().IsZero() || payload.Expired(never) {
+			t.Errorf("expected a payload without timestamp not to expire")
+		}
+	})
+
+	t.Run("test producer stamps payloads", func(t *testing.T) {
+		producer := NewProducer(WithPayloadTTL(time.Minute))
+		payload := newTestPayload("data")
+		before := time.Now()
+		req, err := producer.NewRequest(1, payload, context.Background())
+		if err != nil {
+			t.Fatalf("creating request failed: %v", err)
+		}
+		if payload.Tagged != nil {
+			t.Errorf("expected the caller's payload to be left alone, got %v", payload.Tagged)
+		}
+		got, _ := req.Message.DecodePayload()
+		if got.Timestamp().Before(before) || got.Timestamp().After(time.Now()) || got.TTL() != time.Minute {
+			t.Errorf("expected a fresh timestamp and 1m TTL, got %v and %v", got.Timestamp(), got.TTL())
+		}
+
+		// existing values are kept
+		req, _ = producer.NewRequest(2, newPayload(time.Hour), context.Background())
+		got, _ = req.Message.DecodePayload()
+		if !got.Timestamp().Equal(created) || got.TTL() != time.Hour {
+			t.Errorf("expected the payload's own timestamp and TTL, got %v and %v", got.Timestamp(), got.TTL())
+		}
+
+		req, err = producer.NewRequest(3, NewPayload(1, 42, nil, nil), context.Background())
+		if err != nil {
+			t.Errorf("expected version 1 payloads to be sent without a timestamp, got %v", err)
+		}
+	})
+
+	t.Run("test deadline of encrypted requests", func(t *testing.T) {
+		keys := StaticKeys{42: make([]byte, 32)}
+		sender := NewSerialisable(WithEncryption(keys), WithCompression(CompressionZlib, 0))
+		sender.EncodePayload(newPayload(time.Minute))
+
+		// the receiver has no keys but can still read the tagged fields
+		received := NewSerialisable(WithFraming())
+		received.InsertDataToSerialisableBuffer(sender.buf.Bytes())
+		req := NewRequest(1, received, context.Background())
+		deadline, err := req.Deadline()
+		if err != nil || !deadline.Equal(created.Add(time.Minute)) {
+			t.Errorf("expected deadline %v, got %v (%v)", created.Add(time.Minute), deadline, err)
+		}
+		if !req.Expired(time.Now()) {
+			t.Errorf("expected request to have expired")
+		}
+	})
+}
+
+func TestDispatcherDropsExpiredRequests(t *testing.T) {
+	ctx := context.Background()
+	stale := NewPayload(CurrentPayloadVersion, 1, []byte("origin"), []byte("stale"))
+	stale.SetTimestamp(time.Now().Add(-time.Hour))
+	stale.SetTTL(time.Minute)
+	fresh := NewPayload(CurrentPayloadVersion, 2, []byte("origin"), []byte("fresh"))
+	fresh.SetTTL(time.Hour)
+
+	producer := NewProducer()
+	staleReq, _ := producer.NewRequest(1, stale, ctx)
+	freshReq, _ := producer.NewRequest(2, fresh, ctx)
+
+	var processed atomic.Int32
+	recorder := processorFunc(func(*Request) error {
+		processed.Add(1)
+		return nil
+	})
+
+	sink := make(RequestQueue, 2)
+	dispatcher := NewDispatcher(1, 1)
+	dispatcher.AddQueue(make(RequestQueue, 2))
+	dispatcher.AddExpirySink(sink)
+	dispatcher.Run(recorder)
+	producer.Subscribe(dispatcher)
+
+	if _, err := waitFuture(t, producer.Publish(ctx, staleReq)); !errors.Is(err, ErrExpired) {
+		t.Errorf("expected the stale request to expire, got %v", err)
+	}
+	if _, err := waitFuture(t, producer.Publish(ctx, freshReq)); err != nil {
+		t.Errorf("expected the fresh request to be processed, got %v", err)
+	}
+	if got := processed.Load(); got != 1 {
+		t.Errorf("expected only the fresh request to be processed, got %d", got)
+	}
+
+	select {
+	case req := <-sink:
+		if req.Id != 1 {
+			t.Errorf("expected the stale request in the expiry sink, got %d", req.Id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the stale request in the expiry sink")
+	}
+	if got := dispatcher.Stats().Expired; got != 1 {
+		t.Errorf("expected 1 expired request, got %d", got)
+	}
+}
+
+func TestWorkerDropsExpiredRequests(t *testing.T) {
+	// the request expires after the dispatcher has handed it over
+	payload := NewPayload(CurrentPayloadVersion, 1, []byte("origin"), []byte("data"))
+	payload.SetTimestamp(time.Now())
+	payload.SetTTL(20 * time.Millisecond)
+	req := createAndFormatTestRequest(payload, 1, context.Background())
+
+	processed := make(chan *Request, 1)
+	expired := make(chan *Request, 1)
+	pool := make(chan chan *Request, 1)
+	worker := NewWorker(pool)
+	worker.expire = func(req *Request) { expired <- req }
+	worker.Start(1, processorFunc(func(req *Request) error {
+		processed <- req
+		return nil
+	}))
+	defer worker.Stop()
+
+	requestChannel := <-pool
+	time.Sleep(30 * time.Millisecond)
+	requestChannel <- req
+
+	select {
+	case <-expired:
+	case <-processed:
+		t.Fatalf("expected the expired request not to be processed")
+	case <-time.After(time.Second):
+		t.Fatalf("expected the expired request to be handed to the expiry handler")
+	}
+}
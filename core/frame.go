@@ -0,0 +1,121 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// frame layout (little-endian):
+//
+//	magic    [4]byte "GEWH"
+//	version  uint8   format version of the frame
+//	flags    uint8   bit flags describing the body
+//	content  uint8   ContentType of the body
+//	reserved uint8   zero
+//	length   uint32  total length of the frame, header and trailer included
+//	body     []byte  encoded message
+//	checksum uint32  CRC32C of everything before it
+const (
+	FrameVersion     uint8 = 1
+	FrameHeaderSize        = 12
+	FrameTrailerSize       = 4
+	FrameOverhead          = FrameHeaderSize + FrameTrailerSize
+)
+
+var (
+	frameMagic = [4]byte{'G', 'E', 'W', 'H'}
+	crc32c     = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// header of a frame
+type FrameHeader struct {
+	Version     uint8       // format version of the frame
+	Flags       uint8       // bit flags describing the body
+	ContentType ContentType // encoding of the body
+	Length      uint32      // total length of the frame, header and trailer included
+}
+
+// length of the body carried by the frame
+func (h FrameHeader) BodyLength() int {
+	return int(h.Length) - FrameOverhead
+}
+
+// compression of the Data field of the payload in the frame
+func (h FrameHeader) Compression() Compression {
+	return compressionFromFlags(h.Flags)
+}
+
+// is the Data field of the payload in the frame encrypted
+func (h FrameHeader) Encrypted() bool {
+	return h.Flags&flagEncrypted != 0
+}
+
+// wrap a binary body in a frame and append it to dst
+func AppendFrame(dst []byte, flags uint8, body []byte) []byte {
+	return AppendContentFrame(dst, flags, ContentBinary, body)
+}
+
+// wrap body encoded with the given content type in a frame and append it to dst
+func AppendContentFrame(dst []byte, flags uint8, content ContentType, body []byte) []byte {
+	dst, _ = appendFrameWith(dst, flags, content, func(dst []byte) ([]byte, error) {
+		return append(dst, body...), nil
+	})
+	return dst
+}
+
+// append a frame whose body is appended by appendBody, so the body does not need a buffer of its own
+func appendFrameWith(dst []byte, flags uint8, content ContentType, appendBody func([]byte) ([]byte, error)) ([]byte, error) {
+	start := len(dst)
+	dst = append(dst, frameMagic[:]...)
+	dst = append(dst, FrameVersion, flags, uint8(content), 0, 0, 0, 0, 0)
+	dst, err := appendBody(dst)
+	if err != nil {
+		return dst[:start], err
+	}
+	binary.LittleEndian.PutUint32(dst[start+8:], uint32(len(dst)-start+FrameTrailerSize))
+	return binary.LittleEndian.AppendUint32(dst, crc32.Checksum(dst[start:], crc32c)), nil
+}
+
+// parse and validate the header at the start of b
+func ParseFrameHeader(b []byte) (FrameHeader, error) {
+	if len(b) < FrameHeaderSize {
+		return FrameHeader{}, fmt.Errorf("%w: %d bytes is shorter than a frame header", ErrTruncated, len(b))
+	}
+	if [4]byte(b[0:4]) != frameMagic {
+		return FrameHeader{}, fmt.Errorf("%w: %#x", ErrBadMagic, b[0:4])
+	}
+	header := FrameHeader{
+		Version:     b[4],
+		Flags:       b[5],
+		ContentType: ContentType(b[6]),
+		Length:      binary.LittleEndian.Uint32(b[8:12]),
+	}
+	if header.Version != FrameVersion {
+		return FrameHeader{}, fmt.Errorf("%w: %d", ErrUnsupportedFrame, header.Version)
+	}
+	if header.Length < FrameOverhead {
+		return FrameHeader{}, fmt.Errorf("%w: %d is shorter than the frame overhead", ErrFrameLength, header.Length)
+	}
+	return header, nil
+}
+
+// parse a complete frame and return its header and body, the body aliases frame
+func ParseFrame(frame []byte) (FrameHeader, []byte, error) {
+	header, err := ParseFrameHeader(frame)
+	if err != nil {
+		return FrameHeader{}, nil, err
+	}
+	if len(frame) < int(header.Length) {
+		return FrameHeader{}, nil, fmt.Errorf("%w: frame is %d bytes, header says %d", ErrTruncated, len(frame), header.Length)
+	}
+	if len(frame) > int(header.Length) {
+		return FrameHeader{}, nil, fmt.Errorf("%w: frame is %d bytes, header says %d", ErrFrameLength, len(frame), header.Length)
+	}
+	end := int(header.Length) - FrameTrailerSize
+	want := binary.LittleEndian.Uint32(frame[end:])
+	if got := crc32.Checksum(frame[:end], crc32c); got != want {
+		return FrameHeader{}, nil, fmt.Errorf("%w: got %#08x, want %#08x", ErrChecksum, got, want)
+	}
+	return header, frame[FrameHeaderSize:end], nil
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFrame(t *testing.T) {
+	body := []byte("Hello, World!")
+
+	t.Run("test frame layout", func(t *testing.T) {
+		frame := AppendFrame(nil, 0, body)
+		wantHeader := []byte{
+			'G', 'E', 'W', 'H', // magic
+			0x01,       // frame version
+			0x00,       // flags
+			0x00, 0x00, // reserved
+			0x1d, 0x00, 0x00, 0x00, // total length (uint32, little-endian, 29 bytes)
+		}
+		if !bytes.Equal(frame[:FrameHeaderSize], wantHeader) {
+			t.Errorf("header mismatch: got %#x, want %#x", frame[:FrameHeaderSize], wantHeader)
+		}
+		if len(frame) != len(body)+FrameOverhead {
+			t.Errorf("frame length mismatch: got %d, want %d", len(frame), len(body)+FrameOverhead)
+		}
+
+		header, got, err := ParseFrame(frame)
+		if err != nil {
+			t.Fatalf("parsing failed: %v", err)
+		}
+		if header.BodyLength() != len(body) || !bytes.Equal(got, body) {
+			t.Errorf("body mismatch: got %q, want %q", got, body)
+		}
+	})
+
+	t.Run("test bad frames are rejected", func(t *testing.T) {
+		frame := AppendFrame(nil, 0, body)
+		corrupt := func(fn func(b []byte) []byte) []byte {
+			return fn(append([]byte{}, frame...))
+		}
+		tests := []struct {
+			name  string
+			frame []byte
+			want  error
+		}{
+			{"short header", frame[:5], ErrTruncated},
+			{"truncated body", frame[:len(frame)-1], ErrTruncated},
+			{"bad magic", corrupt(func(b []byte) []byte { b[0] = 'X'; return b }), ErrBadMagic},
+			{"unknown version", corrupt(func(b []byte) []byte { b[4] = 9; return b }), ErrUnsupportedFrame},
+			{"length below overhead", corrupt(func(b []byte) []byte { b[8] = 3; return b }), ErrFrameLength},
+			{"trailing bytes", append(append([]byte{}, frame...), 0x00), ErrFrameLength},
+			{"flipped body bit", corrupt(func(b []byte) []byte { b[FrameHeaderSize] ^= 0x01; return b }), ErrChecksum},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if _, _, err := ParseFrame(tt.frame); !errors.Is(err, tt.want) {
+					t.Errorf("expected %v, got %v", tt.want, err)
+				}
+			})
+		}
+	})
+
+	t.Run("test framed serialisable round trip", func(t *testing.T) {
+		payload := NewPayload(1, 42, []byte("custom token"), body)
+		req := NewRequest(1, NewSerialisable(WithFraming()), context.Background())
+		if err := req.AddPayload(payload); err != nil {
+			t.Fatalf("encoding failed: %v", err)
+		}
+		if !bytes.HasPrefix(req.Message.buf.Bytes(), []byte("GEWH")) {
+			t.Fatalf("expected framed message, got %#x", req.Message.buf.Bytes())
+		}
+
+		got, err := req.Message.DecodePayload()
+		if err != nil {
+			t.Fatalf("decoding failed: %v", err)
+		}
+		if got.ClientId != payload.ClientId || !bytes.Equal(got.Data, payload.Data) {
+			t.Errorf("payload mismatch: got %v, want %v", got, payload)
+		}
+	})
+
+	t.Run("test corrupted serialisable returns typed error", func(t *testing.T) {
+		req := createAndFormatTestRequest(NewPayload(1, 42, []byte("origin"), body), 1, context.Background())
+		received := NewSerialisable(WithFraming())
+		received.InsertDataToSerialisableBuffer(req.Message.buf.Bytes())
+		if _, err := received.DecodePayload(); !errors.Is(err, ErrBadMagic) {
+			t.Errorf("expected ErrBadMagic for unframed input, got %v", err)
+		}
+
+		empty := &Serialisable{Codec: &MessageCodec{}}
+		if _, err := empty.Decode(); !errors.Is(err, ErrEmptyBuffer) {
+			t.Errorf("expected ErrEmptyBuffer, got %v", err)
+		}
+	})
+}
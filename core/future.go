@@ -0,0 +1,153 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// outcome of a published request at one dispatcher
+type Result struct {
+	Dispatcher uint64   // id of the dispatcher
+	Payload    *Payload // payload of the request after processing, nil when it was not processed
+	Err        error    // error of the processor, or why the request was not processed
+}
+
+// handle to a published request, resolved once every dispatcher it was sent to is done with it
+type Future struct {
+	mu        sync.Mutex
+	done      chan struct{}
+	payloads  bool // decode the payload of processed requests for their results
+	pending   int
+	results   []Result
+	callbacks []func(*Payload, error)
+}
+
+func newFuture(subscribers int, payloads bool) *Future {
+	f := &Future{done: make(chan struct{}), pending: subscribers, payloads: payloads}
+	if subscribers == 0 {
+		f.results = []Result{{Err: ErrNoSubscribers}}
+		close(f.done)
+	}
+	return f
+}
+
+// record the result of one dispatcher, the last one resolves the future
+func (f *Future) resolve(result Result) {
+	f.mu.Lock()
+	f.results = append(f.results, result)
+	f.pending--
+	if f.pending > 0 {
+		f.mu.Unlock()
+		return
+	}
+	sort.Slice(f.results, func(i, j int) bool { return f.results[i].Dispatcher < f.results[j].Dispatcher })
+	callbacks := f.callbacks
+	f.callbacks = nil
+	close(f.done)
+	f.mu.Unlock()
+
+	payload, err := f.outcome()
+	for _, fn := range callbacks {
+		fn(payload, err)
+	}
+}
+
+// closed once the future is resolved
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// wait until every dispatcher is done with the request or ctx is done. Returns the payload of
+// the first dispatcher that processed it without an error, along with the errors of the others.
+func (f *Future) Wait(ctx context.Context) (*Payload, error) {
+	select {
+	case <-f.done:
+		return f.outcome()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// call fn with the outcome of Wait once the future is resolved, right away if it already is.
+// Callbacks run on the goroutine that resolves the future, usually a worker, so they should not block.
+func (f *Future) OnComplete(fn func(*Payload, error)) {
+	f.mu.Lock()
+	select {
+	case <-f.done:
+		f.mu.Unlock()
+		fn(f.outcome())
+	default:
+		f.callbacks = append(f.callbacks, fn)
+		f.mu.Unlock()
+	}
+}
+
+// result of every dispatcher ordered by id, nil until the future is resolved
+func (f *Future) Results() []Result {
+	select {
+	case <-f.done:
+		return append([]Result(nil), f.results...)
+	default:
+		return nil
+	}
+}
+
+func (f *Future) outcome() (*Payload, error) {
+	var payload *Payload
+	var errs []error
+	for _, result := range f.results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		} else if payload == nil {
+			payload = result.Payload
+		}
+	}
+	return payload, errors.Join(errs...)
+}
+
+// report that the request was processed to the future it was published with
+func (r *Request) complete(err error) {
+	if r.future == nil {
+		return
+	}
+	var payload *Payload
+	if err == nil && r.future.payloads {
+		payload, err = r.Message.DecodePayload()
+	}
+	r.settle(payload, err)
+}
+
+// report that the request will not be processed
+func (r *Request) fail(err error) {
+	r.settle(nil, err)
+}
+
+func (r *Request) settle(payload *Payload, err error) {
+	if future := r.future; future != nil {
+		r.future = nil
+		future.resolve(Result{Dispatcher: r.subscriber, Payload: payload, Err: err})
+	}
+}
+
+// copy of the request with a message of its own, so every subscriber can process and release it
+func (r *Request) clone() *Request {
+	c := NewRequest(r.Id, r.Message, r.Ctx)
+	c.deadline, c.deadlineKnown = r.deadline, r.deadlineKnown
+	c.Priority = r.Priority
+	if r.Message != nil {
+		message := *r.Message
+		message.pooled = false
+		if codec, ok := r.Message.Codec.(*MessageCodec); ok {
+			copied := *codec
+			message.Codec = &copied
+		}
+		if r.Message.buf != nil {
+			message.buf = bytes.NewBuffer(bytes.Clone(r.Message.buf.Bytes()))
+		}
+		c.Message = &message
+	}
+	return c
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// run a dispatcher with the processor and subscribe it to the producer
+func subscribeDispatcher(producer *Producer, id uint64, p DataProcessor, stages ...Stage) *Dispatcher {
+	dispatcher := NewDispatcher(id, 1)
+	dispatcher.AddQueue(make(RequestQueue, 1))
+	for _, stage := range stages {
+		dispatcher.AddStage(stage)
+	}
+	dispatcher.Run(p)
+	producer.Subscribe(dispatcher)
+	return dispatcher
+}
+
+func TestPublish(t *testing.T) {
+	upper := MockDataProcessingFn(bytes.ToUpper)
+	failure := errors.New("processing failed")
+	failing := processorFunc(func(*Request) error { return failure })
+	newPayload := func() *Payload {
+		return newTestPayload("hello")
+	}
+
+	t.Run("test future resolves with the processed payload", func(t *testing.T) {
+		producer := NewProducer(WithPooledRequests())
+		subscribeDispatcher(producer, 1, upper)
+		req, _ := producer.NewRequest(1, newPayload(), context.Background())
+
+		payload, err := waitFuture(t, producer.Publish(context.Background(), req))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(payload.Data) != "HELLO" {
+			t.Errorf("expected the processed data, got %q", payload.Data)
+		}
+	})
+
+	t.Run("test every subscriber reports its result", func(t *testing.T) {
+		producer := NewProducer()
+		subscribeDispatcher(producer, 1, upper)
+		subscribeDispatcher(producer, 2, failing)
+		req, _ := producer.NewRequest(1, newPayload(), context.Background())
+
+		future := producer.Publish(context.Background(), req)
+		payload, err := waitFuture(t, future)
+		if !errors.Is(err, failure) {
+			t.Errorf("expected the error of the failing dispatcher, got %v", err)
+		}
+		if payload == nil || string(payload.Data) != "HELLO" {
+			t.Errorf("expected the payload of the dispatcher that succeeded, got %v", payload)
+		}
+		results := future.Results()
+		if len(results) != 2 || results[0].Dispatcher != 1 || results[1].Dispatcher != 2 {
+			t.Fatalf("expected a result per dispatcher, got %+v", results)
+		}
+		if results[0].Err != nil || !errors.Is(results[1].Err, failure) || results[1].Payload != nil {
+			t.Errorf("unexpected results %+v", results)
+		}
+	})
+
+	t.Run("test requests that are not processed resolve with the reason", func(t *testing.T) {
+		producer := NewProducer(WithoutResultPayloads())
+		rejected := errors.New("rejected")
+		subscribeDispatcher(producer, 1, upper, StageFunc(func(*Request) error { return rejected }))
+		req, _ := producer.NewRequest(1, newPayload(), context.Background())
+		if _, err := waitFuture(t, producer.Publish(context.Background(), req)); !errors.Is(err, rejected) {
+			t.Errorf("expected the stage error, got %v", err)
+		}
+
+		stale := newPayload()
+		stale.SetTimestamp(time.Now().Add(-time.Hour))
+		stale.SetTTL(time.Minute)
+		req, _ = producer.NewRequest(2, stale, context.Background())
+		if _, err := waitFuture(t, producer.Publish(context.Background(), req)); !errors.Is(err, ErrExpired) {
+			t.Errorf("expected ErrExpired, got %v", err)
+		}
+
+		if _, err := waitFuture(t, NewProducer().Publish(context.Background(), req)); !errors.Is(err, ErrNoSubscribers) {
+			t.Errorf("expected ErrNoSubscribers, got %v", err)
+		}
+	})
+
+	t.Run("test undelivered requests resolve with an error", func(t *testing.T) {
+		producer := NewProducer(WithBroadcastTimeout[any](10 * time.Millisecond))
+		producer.Subscribe(NewDispatcher(1, 1)) // its queue is never read
+		req, _ := producer.NewRequest(1, newPayload(), context.Background())
+		if _, err := waitFuture(t, producer.Publish(context.Background(), req)); !errors.Is(err, ErrNotDelivered) {
+			t.Errorf("expected ErrNotDelivered, got %v", err)
+		}
+	})
+
+	t.Run("test callbacks and waiting", func(t *testing.T) {
+		producer := NewProducer(WithoutResultPayloads())
+		release := make(chan struct{})
+		subscribeDispatcher(producer, 1, processorFunc(func(*Request) error {
+			<-release
+			return nil
+		}))
+		req, _ := producer.NewRequest(1, newPayload(), context.Background())
+		future := producer.Publish(context.Background(), req)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := future.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected Wait to give up with its context, got %v", err)
+		}
+		if future.Results() != nil {
+			t.Error("expected no results before the future is resolved")
+		}
+
+		called := make(chan error, 2)
+		future.OnComplete(func(payload *Payload, err error) { called <- err })
+		close(release)
+		<-future.Done()
+		future.OnComplete(func(payload *Payload, err error) { called <- err })
+		for i := 0; i < 2; i++ {
+			select {
+			case err := <-called:
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("callback was not called")
+			}
+		}
+	})
+}
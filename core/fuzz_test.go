@@ -0,0 +1,87 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func fuzzSeeds(f *testing.F) {
+	payloads := []*Payload{
+		NewPayload(1, 42, []byte("origin"), []byte("Hello, World!")),
+		NewPayload(CurrentPayloadVersion, 7, nil, nil),
+		{Version: CurrentPayloadVersion, ClientId: 1, Data: []byte("a,b,c"), Headers: Headers{{"content-type", "text/csv"}}},
+		{Version: CurrentPayloadVersion, ClientId: 1, Tagged: TaggedFields{{1, []byte{1, 0}}, {TagApplication, []byte("x")}}},
+	}
+	for _, payload := range payloads {
+		encoded, _ := payload.MarshalBinary()
+		f.Add(encoded)
+		f.Add(AppendFrame(nil, 0, encoded))
+		encoded, _ = MessagePackContent{}.AppendPayload(nil, payload)
+		f.Add(AppendContentFrame(nil, 0, ContentMessagePack, encoded))
+		f.Add(AppendContentFrame(nil, 0, ContentJSON, payload.MarshalToJson()))
+	}
+	f.Add([]byte{})
+	f.Add([]byte{1, 0, 42, 0, 0xFF, 0xFF, 0xFF, 0xFF})
+}
+
+// decoding arbitrary bytes must fail with an error rather than panic or allocate without bound
+func FuzzDecode(f *testing.F) {
+	fuzzSeeds(f)
+	limits := WithDecodeLimits(DecodeLimits{MaxFieldSize: 1 << 16, MaxMessageSize: 1 << 20})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, schema := range []Schema{PayloadSchemaV1, PayloadSchema} {
+			s := NewSerialisable(limits)
+			s.Codec.AddSchema(schema)
+			s.InsertDataToSerialisableBuffer(data)
+			fields, err := s.Decode()
+			if err != nil {
+				continue
+			}
+			if err := new(Payload).FromFields(fields); err != nil {
+				t.Errorf("decoded fields do not form a payload: %v", err)
+			}
+		}
+
+		for _, opt := range []SerialisableOpt{WithFraming(), WithCodecRegistry(DefaultCodecRegistry)} {
+			s := NewSerialisable(limits, opt)
+			s.InsertDataToSerialisableBuffer(data)
+			s.DecodePayload()
+		}
+	})
+}
+
+// FromFields must report fields of any name or type instead of panicking
+func FuzzFromFields(f *testing.F) {
+	f.Add("Version", uint8(0), []byte{1, 0})
+	f.Add("Data", uint8(4), []byte("Hello, World!"))
+	f.Add("Headers", uint8(6), []byte("content-type"))
+	f.Add("Unknown", uint8(5), []byte{})
+	f.Fuzz(func(t *testing.T, name string, kind uint8, data []byte) {
+		var value interface{}
+		switch kind % 8 {
+		case 0:
+			var v uint16
+			if len(data) >= 2 {
+				v = uint16(data[0]) | uint16(data[1])<<8
+			}
+			value = &v
+		case 1:
+			value = uint16(len(data))
+		case 2:
+			value = string(data)
+		case 3:
+			var nilBytes *[]byte
+			value = nilBytes
+		case 4:
+			value = data
+		case 5:
+			value = nil
+		case 6:
+			value = []ByteFields{{{"Key", reflect.TypeOf(""), string(data)}, {"Value", reflect.TypeOf(data), data}}}
+		case 7:
+			value = &data
+		}
+		fields := ByteFields{{name, reflect.TypeOf(value), value}}
+		new(Payload).FromFields(fields)
+	})
+}
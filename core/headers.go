@@ -0,0 +1,96 @@
+package core
+
+import (
+	"reflect"
+)
+
+// key/value metadata carried alongside the data of a payload, such as content type,
+// trace ids or routing keys
+type Header struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ordered list of headers, keys may repeat
+type Headers []Header
+
+// wire layout of a single header
+var HeaderSchema = Schema{
+	{Name: "Key", Kind: KindString},
+	{Name: "Value", Kind: KindString},
+}
+
+// get the value of the first header with the given key
+func (h Headers) Get(key string) (string, bool) {
+	for _, header := range h {
+		if header.Key == key {
+			return header.Value, true
+		}
+	}
+	return "", false
+}
+
+// get all values of headers with the given key, in order
+func (h Headers) Values(key string) []string {
+	var values []string
+	for _, header := range h {
+		if header.Key == key {
+			values = append(values, header.Value)
+		}
+	}
+	return values
+}
+
+// add a header, keeping any existing headers with the same key
+func (p *Payload) AddHeader(key, value string) {
+	p.Headers = append(p.Headers, Header{key, value})
+}
+
+// set the header to a single value, replacing any existing headers with the same key
+func (p *Payload) SetHeader(key, value string) {
+	p.DelHeader(key)
+	p.AddHeader(key, value)
+}
+
+// remove all headers with the given key
+func (p *Payload) DelHeader(key string) {
+	var headers Headers
+	for _, header := range p.Headers {
+		if header.Key != key {
+			headers = append(headers, header)
+		}
+	}
+	p.Headers = headers
+}
+
+// transform headers into list elements for the schema codec
+func (h Headers) toFields() []ByteFields {
+	list := make([]ByteFields, len(h))
+	stringType := reflect.TypeOf("")
+	for i := range h {
+		list[i] = ByteFields{
+			{"Key", stringType, &h[i].Key},
+			{"Value", stringType, &h[i].Value},
+		}
+	}
+	return list
+}
+
+// transform list elements decoded by the schema codec into headers
+func headersFromFields(list []ByteFields) Headers {
+	if len(list) == 0 {
+		return nil
+	}
+	headers := make(Headers, 0, len(list))
+	for _, fields := range list {
+		var header Header
+		if key, ok := fields.Get("Key"); ok {
+			header.Key, _ = FieldValue[string](key)
+		}
+		if value, ok := fields.Get("Value"); ok {
+			header.Value, _ = FieldValue[string](value)
+		}
+		headers = append(headers, header)
+	}
+	return headers
+}
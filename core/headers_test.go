@@ -0,0 +1,115 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	newPayload := func() *Payload {
+		return newTestPayload("Hello, World!", "content-type", "text/csv", "route", "eu", "route", "us")
+	}
+
+	t.Run("test header lookups", func(t *testing.T) {
+		payload := newPayload()
+		if got, ok := payload.Headers.Get("route"); !ok || got != "eu" {
+			t.Errorf("expected first route header, got %q", got)
+		}
+		if got := payload.Headers.Values("route"); !reflect.DeepEqual(got, []string{"eu", "us"}) {
+			t.Errorf("expected both route headers, got %v", got)
+		}
+		if _, ok := payload.Headers.Get("missing"); ok {
+			t.Errorf("expected missing header")
+		}
+
+		payload.SetHeader("route", "ap")
+		want := Headers{{"content-type", "text/csv"}, {"route", "ap"}}
+		if !reflect.DeepEqual(payload.Headers, want) {
+			t.Errorf("headers mismatch after set: got %v, want %v", payload.Headers, want)
+		}
+		payload.DelHeader("route")
+		payload.DelHeader("content-type")
+		if payload.Headers != nil {
+			t.Errorf("expected no headers, got %v", payload.Headers)
+		}
+	})
+
+	t.Run("test headers survive encoding and processing", func(t *testing.T) {
+		req := createAndFormatTestRequest(newPayload(), 1, context.Background())
+		headers, err := req.Headers()
+		if err != nil {
+			t.Fatalf("decoding headers failed: %v", err)
+		}
+		if !reflect.DeepEqual(headers, newPayload().Headers) {
+			t.Errorf("headers mismatch: got %v, want %v", headers, newPayload().Headers)
+		}
+
+		var seen Headers
+		cb := MockDataProcessingFn(func(field []byte) []byte { return field })
+		processor := headerRecorder{cb, &seen}
+		if err := processor.Process(req); err != nil {
+			t.Fatalf("processing failed: %v", err)
+		}
+		if !reflect.DeepEqual(seen, newPayload().Headers) {
+			t.Errorf("processor saw %v", seen)
+		}
+	})
+
+	t.Run("test headers through the schema codec", func(t *testing.T) {
+		payload := newPayload()
+		s := NewSerialisable()
+		s.Codec.AddFields(payload.ToFields())
+		if err := s.Encode(); err != nil {
+			t.Fatalf("encoding failed: %v", err)
+		}
+		fields, err := s.Decode()
+		if err != nil {
+			t.Fatalf("decoding failed: %v", err)
+		}
+		got := Payload{}
+		got.FromFields(fields)
+		if !reflect.DeepEqual(&got, payload) {
+			t.Errorf("payload mismatch: got %v, want %v", got, payload)
+		}
+	})
+
+	t.Run("test json form", func(t *testing.T) {
+		got := Payload{}
+		got.UnmarshalJson(newPayload().MarshalToJson())
+		if !reflect.DeepEqual(&got, newPayload()) {
+			t.Errorf("payload mismatch: got %v", got)
+		}
+
+		var raw map[string]interface{}
+		json.Unmarshal(NewPayload(1, 1, nil, nil).MarshalToJson(), &raw)
+		if _, ok := raw["headers"]; ok {
+			t.Errorf("expected headers to be omitted when empty")
+		}
+	})
+
+	t.Run("test version 1 payloads cannot carry headers", func(t *testing.T) {
+		payload := newPayload()
+		payload.Version = 1
+		if err := NewSerialisable().EncodePayload(payload); !errors.Is(err, ErrHeadersUnsupported) {
+			t.Errorf("expected ErrHeadersUnsupported, got %v", err)
+		}
+	})
+}
+
+// records the headers of every request before handing it on
+type headerRecorder struct {
+	next DataProcessor
+	seen *Headers
+}
+
+func (h headerRecorder) Process(req *Request) error {
+	payload, err := req.Message.DecodePayload()
+	if err != nil {
+		return err
+	}
+	*h.seen = payload.Headers
+	return h.next.Process(req)
+}
@@ -0,0 +1,38 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// version 2 payload of client 42 from "origin" with data and header key, value pairs
+func newTestPayload(data string, headers ...string) *Payload {
+	if len(headers)%2 != 0 {
+		panic("newTestPayload: headers must be key, value pairs")
+	}
+	payload := NewPayload(CurrentPayloadVersion, 42, []byte("origin"), []byte(data))
+	for i := 0; i < len(headers); i += 2 {
+		payload.AddHeader(headers[i], headers[i+1])
+	}
+	return payload
+}
+
+// outcome of the future, the test fails when it is not resolved within a second
+func waitFuture(t testing.TB, future *Future) (*Payload, error) {
+	t.Helper()
+	select {
+	case <-future.Done():
+		return future.Wait(context.Background())
+	case <-time.After(time.Second):
+		t.Fatal("future was not resolved")
+		return nil, nil
+	}
+}
+
+// adapter to use a function as a DataProcessor in tests
+type processorFunc func(*Request) error
+
+func (fn processorFunc) Process(req *Request) error {
+	return fn(req)
+}
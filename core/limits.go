@@ -0,0 +1,70 @@
+package core
+
+import (
+	"fmt"
+)
+
+// bounds applied when decoding, so a corrupt or hostile length prefix fails with
+// ErrLengthTooLarge instead of allocating. Zero values use DefaultDecodeLimits.
+type DecodeLimits struct {
+	MaxFieldSize   int // largest bytes, string or list field, and largest decompressed Data
+	MaxMessageSize int // largest encoded message, frame included
+}
+
+var DefaultDecodeLimits = DecodeLimits{
+	MaxFieldSize:   16 << 20,
+	MaxMessageSize: 64 << 20,
+}
+
+// decode messages with the given limits instead of DefaultDecodeLimits
+func WithDecodeLimits(limits DecodeLimits) SerialisableOpt {
+	return func(s *Serialisable) {
+		s.limits = limits
+	}
+}
+
+// limits with defaults filled in for unset values
+func (l DecodeLimits) orDefault() DecodeLimits {
+	if l.MaxFieldSize <= 0 {
+		l.MaxFieldSize = DefaultDecodeLimits.MaxFieldSize
+	}
+	if l.MaxMessageSize <= 0 {
+		l.MaxMessageSize = DefaultDecodeLimits.MaxMessageSize
+	}
+	return l
+}
+
+func (l DecodeLimits) checkField(name string, size int) error {
+	if size > l.MaxFieldSize {
+		return fmt.Errorf("field %s: %w: %d bytes, limit is %d", name, ErrLengthTooLarge, size, l.MaxFieldSize)
+	}
+	return nil
+}
+
+func (l DecodeLimits) checkMessage(size int) error {
+	if size > l.MaxMessageSize {
+		return fmt.Errorf("%w: message of %d bytes, limit is %d", ErrLengthTooLarge, size, l.MaxMessageSize)
+	}
+	return nil
+}
+
+// check the variable sized fields of a payload decoded without a FieldDecoder
+func (l DecodeLimits) checkPayload(p *Payload) error {
+	if err := l.checkField("Identifier", len(p.Identifier)); err != nil {
+		return err
+	}
+	if err := l.checkField("Data", len(p.Data)); err != nil {
+		return err
+	}
+	for _, header := range p.Headers {
+		if err := l.checkField("Headers", len(header.Key)+len(header.Value)); err != nil {
+			return err
+		}
+	}
+	for _, field := range p.Tagged {
+		if err := l.checkField("Tagged", len(field.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeLimits(t *testing.T) {
+	// version, client id and an Identifier length prefix claiming 4 GB
+	hostile := binary.LittleEndian.AppendUint16(nil, 1)
+	hostile = binary.LittleEndian.AppendUint16(hostile, 42)
+	hostile = binary.LittleEndian.AppendUint32(hostile, 0xFFFFFFFF)
+
+	t.Run("test hostile length prefix", func(t *testing.T) {
+		s := NewSerialisable()
+		s.Codec.AddSchema(PayloadSchemaV1)
+		s.InsertDataToSerialisableBuffer(hostile)
+		if _, err := s.Decode(); !errors.Is(err, ErrLengthTooLarge) {
+			t.Errorf("expected ErrLengthTooLarge, got %v", err)
+		}
+
+		limited := NewSerialisable(WithDecodeLimits(DecodeLimits{MaxFieldSize: 1 << 40}))
+		limited.Codec.AddSchema(PayloadSchemaV1)
+		limited.InsertDataToSerialisableBuffer(hostile)
+		if _, err := limited.Decode(); !errors.Is(err, ErrTruncated) {
+			t.Errorf("expected ErrTruncated when the limit allows the length, got %v", err)
+		}
+	})
+
+	t.Run("test truncated messages", func(t *testing.T) {
+		s := NewSerialisable()
+		s.EncodePayload(NewPayload(1, 42, []byte("origin"), []byte("Hello, World!")))
+		encoded := s.buf.Bytes()
+		for n := 0; n < len(encoded); n++ {
+			truncated := NewSerialisable()
+			truncated.Codec.AddSchema(PayloadSchemaV1)
+			truncated.InsertDataToSerialisableBuffer(encoded[:n])
+			if _, err := truncated.Decode(); !errors.Is(err, ErrTruncated) {
+				t.Errorf("%d bytes: expected ErrTruncated, got %v", n, err)
+			}
+		}
+	})
+
+	t.Run("test field and message limits", func(t *testing.T) {
+		payload := NewPayload(CurrentPayloadVersion, 42, []byte("origin"), bytes.Repeat([]byte("x"), 100))
+		cases := map[string]DecodeLimits{
+			"field":   {MaxFieldSize: 99},
+			"message": {MaxMessageSize: 99},
+		}
+		for name, limits := range cases {
+			encoder := NewSerialisable(WithFraming())
+			encoder.EncodePayload(payload)
+			s := NewSerialisable(WithFraming(), WithDecodeLimits(limits))
+			s.InsertDataToSerialisableBuffer(encoder.buf.Bytes())
+			if _, err := s.DecodePayload(); !errors.Is(err, ErrLengthTooLarge) {
+				t.Errorf("%s: expected ErrLengthTooLarge, got %v", name, err)
+			}
+
+			// the registry decodes with the limits of the serialisable too
+			s = NewSerialisable(WithFraming(), WithDecodeLimits(limits))
+			s.InsertDataToSerialisableBuffer(encoder.buf.Bytes())
+			if _, err := DefaultCodecRegistry.Decode(s); !errors.Is(err, ErrLengthTooLarge) {
+				t.Errorf("%s: expected ErrLengthTooLarge from the registry, got %v", name, err)
+			}
+		}
+
+		fr := NewFrameReader(bytes.NewReader(AppendFrame(nil, 0, make([]byte, 100))), WithDecodeLimits(DecodeLimits{MaxMessageSize: 99}))
+		if _, err := fr.ReadFrame(); !errors.Is(err, ErrLengthTooLarge) {
+			t.Errorf("frame reader: expected ErrLengthTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("test decompression is bounded", func(t *testing.T) {
+		payload := NewPayload(CurrentPayloadVersion, 42, nil, make([]byte, 1<<20))
+		encoder := NewSerialisable(WithCompression(CompressionGzip, 0))
+		if err := encoder.EncodePayload(payload); err != nil {
+			t.Fatalf("encoding failed: %v", err)
+		}
+		s := NewSerialisable(WithFraming(), WithDecodeLimits(DecodeLimits{MaxFieldSize: 1 << 16}))
+		s.InsertDataToSerialisableBuffer(encoder.buf.Bytes())
+		if _, err := s.DecodePayload(); !errors.Is(err, ErrLengthTooLarge) {
+			t.Errorf("expected ErrLengthTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("test unknown kind", func(t *testing.T) {
+		s := NewSerialisable()
+		s.Codec.AddSchema(Schema{{Name: "Id", Kind: "complex128"}})
+		s.InsertDataToSerialisableBuffer(make([]byte, 16))
+		if _, err := s.Decode(); !errors.Is(err, ErrUnknownField) {
+			t.Errorf("expected ErrUnknownField, got %v", err)
+		}
+	})
+}
+
+func TestFromFieldsErrors(t *testing.T) {
+	version, clientId := uint16(1), uint16(42)
+	data := []byte("Hello, World!")
+
+	payload := Payload{}
+	err := payload.FromFields(ByteFields{
+		{"Version", reflect.TypeOf(version), &version},
+		{"Checksum", reflect.TypeOf(clientId), &clientId},
+		{"Data", reflect.TypeOf(data), data},
+	})
+	if !errors.Is(err, ErrUnknownField) {
+		t.Errorf("expected ErrUnknownField, got %v", err)
+	}
+	if payload.Version != 1 || !bytes.Equal(payload.Data, data) {
+		t.Errorf("expected known fields to be applied, got %v", payload)
+	}
+
+	err = payload.FromFields(ByteFields{{"ClientId", reflect.TypeOf(data), data}})
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("expected ErrTypeMismatch, got %v", err)
+	}
+
+	s := NewSerialisable()
+	s.Codec.AddSchema(Schema{{Name: "Version", Kind: KindUint16}})
+	s.Codec.AddFields(ByteFields{{"Version", reflect.TypeOf(data), data}})
+	if err := s.Encode(); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("expected ErrTypeMismatch when encoding, got %v", err)
+	}
+}
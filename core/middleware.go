@@ -0,0 +1,104 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+// wraps a processor with behaviour of its own, such as logging or limits. Middleware built into
+// gewh returns a processor that also implements ContextProcessor and passes its context on.
+type Middleware func(DataProcessor) DataProcessor
+
+// wrap p with the middleware, the first one is the outermost and sees a request first
+func Chain(p DataProcessor, middleware ...Middleware) DataProcessor {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		p = middleware[i](p)
+	}
+	return p
+}
+
+// middleware calling fn with the processor it wraps, adapted to a ContextProcessor
+func contextMiddleware(fn func(ctx context.Context, req *Request, next ContextProcessor) error) Middleware {
+	return func(p DataProcessor) DataProcessor {
+		next := AdaptProcessor(p)
+		return ContextProcessorFunc(func(ctx context.Context, req *Request) error {
+			return fn(ctx, req, next)
+		})
+	}
+}
+
+// turn a panic in the processor into an error wrapping ErrPanic, so the worker survives it
+func Recover() Middleware {
+	return contextMiddleware(func(ctx context.Context, req *Request, next ContextProcessor) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%w: %v\n%s", ErrPanic, r, debug.Stack())
+			}
+		}()
+		return next.ProcessContext(ctx, req)
+	})
+}
+
+// stop processing a request after d. The error wraps ErrTimeout and context.DeadlineExceeded
+// when the processor gives up because of it, and DefaultRetryable retries it.
+func Timeout(d time.Duration) Middleware {
+	return contextMiddleware(func(ctx context.Context, req *Request, next ContextProcessor) error {
+		ctx, cancel := context.WithTimeoutCause(ctx, d, ErrTimeout)
+		defer cancel()
+		err := next.ProcessContext(ctx, req)
+		if errors.Is(err, context.DeadlineExceeded) && errors.Is(context.Cause(ctx), ErrTimeout) {
+			err = fmt.Errorf("%w: %w", ErrTimeout, err)
+		}
+		return err
+	})
+}
+
+// log every processed request to logger, slog.Default() when nil. Failures are logged at error
+// level and the rest at debug level.
+func Logging(logger *slog.Logger) Middleware {
+	return contextMiddleware(func(ctx context.Context, req *Request, next ContextProcessor) error {
+		l := logger
+		if l == nil {
+			l = slog.Default()
+		}
+		start := time.Now()
+		err := next.ProcessContext(ctx, req)
+		attrs := []slog.Attr{slog.Int("request", req.Id), slog.Duration("duration", time.Since(start))}
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "request failed", append(attrs, slog.Any("error", err))...)
+		} else {
+			l.LogAttrs(ctx, slog.LevelDebug, "request processed", attrs...)
+		}
+		return err
+	})
+}
+
+// call observe with how long every request took to process and its error
+func Latency(observe func(req *Request, d time.Duration, err error)) Middleware {
+	return contextMiddleware(func(ctx context.Context, req *Request, next ContextProcessor) error {
+		start := time.Now()
+		err := next.ProcessContext(ctx, req)
+		observe(req, time.Since(start), err)
+		return err
+	})
+}
+
+// process at most n requests at once across every processor the middleware wraps, so a limit
+// can be shared by dispatchers. Requests wait for a slot until their context is done. n below 1
+// is taken as 1.
+func Limit(n int) Middleware {
+	slots := make(chan struct{}, max(n, 1))
+	return contextMiddleware(func(ctx context.Context, req *Request, next ContextProcessor) error {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		defer func() { <-slots }()
+		return next.ProcessContext(ctx, req)
+	})
+}
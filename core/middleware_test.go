@@ -0,0 +1,159 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	ok := processorFunc(func(*Request) error { return nil })
+	failure := errors.New("processing failed")
+	// processor that runs until it is stopped
+	blocking := ContextProcessorFunc(func(ctx context.Context, req *Request) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	t.Run("test chain order", func(t *testing.T) {
+		var order []string
+		record := func(name string) Middleware {
+			return func(next DataProcessor) DataProcessor {
+				return processorFunc(func(req *Request) error {
+					order = append(order, name)
+					return next.Process(req)
+				})
+			}
+		}
+		p := Chain(processorFunc(func(*Request) error {
+			order = append(order, "processor")
+			return nil
+		}), record("outer"), record("inner"))
+		p.Process(&Request{})
+		if got := strings.Join(order, ","); got != "outer,inner,processor" {
+			t.Errorf("expected the first middleware to be outermost, got %s", got)
+		}
+	})
+
+	t.Run("test recover", func(t *testing.T) {
+		p := Chain(processorFunc(func(*Request) error { panic("boom") }), Recover())
+		if err := p.Process(&Request{Ctx: context.Background()}); !errors.Is(err, ErrPanic) || !strings.Contains(err.Error(), "boom") {
+			t.Errorf("expected ErrPanic, got %v", err)
+		}
+	})
+
+	t.Run("test timeout", func(t *testing.T) {
+		p := AdaptProcessor(Chain(blocking, Timeout(10*time.Millisecond)))
+		err := p.ProcessContext(context.Background(), &Request{})
+		if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected ErrTimeout, got %v", err)
+		}
+		if !DefaultRetryable(err) {
+			t.Error("expected timeouts to be retried")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := p.ProcessContext(ctx, &Request{}); errors.Is(err, ErrTimeout) || !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the cancellation to be returned as it is, got %v", err)
+		}
+	})
+
+	t.Run("test logging", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		Chain(ok, Logging(logger)).Process(&Request{Id: 1, Ctx: context.Background()})
+		Chain(processorFunc(func(*Request) error { return failure }), Logging(logger)).Process(&Request{Id: 2, Ctx: context.Background()})
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("expected a line per request, got %q", buf.String())
+		}
+		if !strings.Contains(lines[0], "level=DEBUG") || !strings.Contains(lines[0], "request=1") || !strings.Contains(lines[0], "duration=") {
+			t.Errorf("unexpected line %q", lines[0])
+		}
+		if !strings.Contains(lines[1], "level=ERROR") || !strings.Contains(lines[1], "request=2") || !strings.Contains(lines[1], `error="processing failed"`) {
+			t.Errorf("unexpected line %q", lines[1])
+		}
+	})
+
+	t.Run("test latency", func(t *testing.T) {
+		var observed time.Duration
+		var observedErr error
+		slow := processorFunc(func(*Request) error {
+			time.Sleep(5 * time.Millisecond)
+			return failure
+		})
+		Chain(slow, Latency(func(_ *Request, d time.Duration, err error) {
+			observed, observedErr = d, err
+		})).Process(&Request{Ctx: context.Background()})
+		if observed < 5*time.Millisecond || !errors.Is(observedErr, failure) {
+			t.Errorf("expected the duration and error to be observed, got %v %v", observed, observedErr)
+		}
+	})
+
+	t.Run("test limit", func(t *testing.T) {
+		var running, most atomic.Int32
+		counting := processorFunc(func(*Request) error {
+			n := running.Add(1)
+			for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+			return nil
+		})
+		limit := Limit(2)
+		// the limit is shared by every processor it wraps
+		a, b := Chain(counting, limit), Chain(counting, limit)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(p DataProcessor) {
+				defer wg.Done()
+				p.Process(&Request{Ctx: context.Background()})
+			}([]DataProcessor{a, b}[i%2])
+		}
+		wg.Wait()
+		if most.Load() != 2 {
+			t.Errorf("expected at most 2 requests at once, got %d", most.Load())
+		}
+
+		if err := Chain(ok, Limit(0)).Process(&Request{Ctx: context.Background()}); err != nil {
+			t.Errorf("expected a limit of 0 to process one request at a time, got %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		full := Chain(blocking, Limit(1))
+		go full.Process(&Request{Ctx: ctx})
+		time.Sleep(time.Millisecond)
+		if err := AdaptProcessor(full).ProcessContext(ctx, &Request{}); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected waiting for a slot to stop with the context, got %v", err)
+		}
+	})
+}
+
+func TestDispatcherMiddleware(t *testing.T) {
+	producer := NewProducer(WithoutResultPayloads())
+	dispatcher := NewDispatcher(1, 1)
+	dispatcher.AddQueue(make(RequestQueue, 1))
+	observed := make(chan error, 1)
+	dispatcher.Use(Latency(func(_ *Request, _ time.Duration, err error) { observed <- err }))
+	dispatcher.Use(Recover())
+	dispatcher.Run(processorFunc(func(*Request) error { panic("boom") }))
+	producer.Subscribe(dispatcher)
+
+	req, _ := producer.NewRequest(1, NewPayload(CurrentPayloadVersion, 1, nil, []byte("data")), context.Background())
+	if _, err := waitFuture(t, producer.Publish(context.Background(), req)); !errors.Is(err, ErrPanic) {
+		t.Errorf("expected the panic to be recovered, got %v", err)
+	}
+	if err := <-observed; !errors.Is(err, ErrPanic) {
+		t.Errorf("expected the outer middleware to see the recovered panic, got %v", err)
+	}
+}
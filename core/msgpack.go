@@ -0,0 +1,446 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Hand-written MessagePack encoding of a Payload. A payload is a map keyed like its
+// JSON form:
+//
+//	{"version": uint, "clientId": uint, "identifier": bin, "data": bin, "headers": [{"key": str, "value": str}]}
+//
+// headers and tagged fields are left out when empty, tagged fields are an array of
+// {"tag": uint, "value": bin} maps. Decoding also accepts str for the byte fields, nil for
+// empty values and skips unknown keys, so producers in other languages can use any
+// MessagePack library.
+type MessagePackContent struct{}
+
+// deepest nesting of arrays and maps skipped when decoding
+const msgpackMaxDepth = 32
+
+func (MessagePackContent) ContentType() ContentType {
+	return ContentMessagePack
+}
+
+func (MessagePackContent) AppendPayload(dst []byte, payload *Payload) ([]byte, error) {
+	if uint64(len(payload.Identifier)) > math.MaxUint32 || uint64(len(payload.Data)) > math.MaxUint32 {
+		return dst, fmt.Errorf("payload field does not fit in a uint32 length")
+	}
+	entries := 4
+	if len(payload.Headers) > 0 {
+		entries++
+	}
+	if len(payload.Tagged) > 0 {
+		entries++
+	}
+	dst = appendMsgpackMap(dst, entries)
+	dst = appendMsgpackString(dst, "version")
+	dst = appendMsgpackUint(dst, uint64(payload.Version))
+	dst = appendMsgpackString(dst, "clientId")
+	dst = appendMsgpackUint(dst, uint64(payload.ClientId))
+	dst = appendMsgpackString(dst, "identifier")
+	dst = appendMsgpackBytes(dst, payload.Identifier)
+	dst = appendMsgpackString(dst, "data")
+	dst = appendMsgpackBytes(dst, payload.Data)
+	if len(payload.Headers) > 0 {
+		dst = appendMsgpackString(dst, "headers")
+		dst = appendMsgpackArray(dst, len(payload.Headers))
+		for _, header := range payload.Headers {
+			dst = appendMsgpackMap(dst, 2)
+			dst = appendMsgpackString(dst, "key")
+			dst = appendMsgpackString(dst, header.Key)
+			dst = appendMsgpackString(dst, "value")
+			dst = appendMsgpackString(dst, header.Value)
+		}
+	}
+	if len(payload.Tagged) > 0 {
+		dst = appendMsgpackString(dst, "tagged")
+		dst = appendMsgpackArray(dst, len(payload.Tagged))
+		for _, field := range payload.Tagged {
+			dst = appendMsgpackMap(dst, 2)
+			dst = appendMsgpackString(dst, "tag")
+			dst = appendMsgpackUint(dst, uint64(field.Tag))
+			dst = appendMsgpackString(dst, "value")
+			dst = appendMsgpackBytes(dst, field.Value)
+		}
+	}
+	return dst, nil
+}
+
+func (MessagePackContent) DecodePayload(data []byte, payload *Payload) error {
+	*payload = Payload{}
+	r := &msgpackReader{b: data}
+	entries, err := r.readMap()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < entries; i++ {
+		key, err := r.readString()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "version":
+			payload.Version, err = r.readUint16()
+		case "clientId":
+			payload.ClientId, err = r.readUint16()
+		case "identifier":
+			payload.Identifier, err = r.readBytes()
+		case "data":
+			payload.Data, err = r.readBytes()
+		case "headers":
+			payload.Headers, err = r.readHeaders()
+		case "tagged":
+			payload.Tagged, err = r.readTagged()
+		default:
+			err = r.skip(0)
+		}
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key, err)
+		}
+	}
+	if len(r.b) > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrBadContent, len(r.b))
+	}
+	return nil
+}
+
+func appendMsgpackUint(dst []byte, v uint64) []byte {
+	switch {
+	case v < 0x80:
+		return append(dst, uint8(v))
+	case v <= math.MaxUint8:
+		return append(dst, 0xcc, uint8(v))
+	case v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(dst, 0xce), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(dst, 0xcf), v)
+}
+
+// append a header for a str, bin, array or map of n items using the smallest format
+func appendMsgpackHeader(dst []byte, n int, fix, fixMax uint8, formats [3]uint8) []byte {
+	switch {
+	case fix != 0 && n <= int(fixMax):
+		return append(dst, fix|uint8(n))
+	case formats[0] != 0 && n <= math.MaxUint8:
+		return append(dst, formats[0], uint8(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, formats[1]), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(dst, formats[2]), uint32(n))
+}
+
+func appendMsgpackString(dst []byte, s string) []byte {
+	dst = appendMsgpackHeader(dst, len(s), 0xa0, 31, [3]uint8{0xd9, 0xda, 0xdb})
+	return append(dst, s...)
+}
+
+func appendMsgpackBytes(dst []byte, b []byte) []byte {
+	if b == nil {
+		return append(dst, 0xc0)
+	}
+	dst = appendMsgpackHeader(dst, len(b), 0, 0, [3]uint8{0xc4, 0xc5, 0xc6})
+	return append(dst, b...)
+}
+
+func appendMsgpackArray(dst []byte, n int) []byte {
+	return appendMsgpackHeader(dst, n, 0x90, 15, [3]uint8{0, 0xdc, 0xdd})
+}
+
+func appendMsgpackMap(dst []byte, n int) []byte {
+	return appendMsgpackHeader(dst, n, 0x80, 15, [3]uint8{0, 0xde, 0xdf})
+}
+
+// reads MessagePack values from the start of b
+type msgpackReader struct {
+	b []byte
+}
+
+func (r *msgpackReader) next(n int) ([]byte, error) {
+	if n < 0 || n > len(r.b) {
+		return nil, fmt.Errorf("%w: %d bytes needed, %d left", ErrTruncated, n, len(r.b))
+	}
+	b := r.b[:n:n]
+	r.b = r.b[n:]
+	return b, nil
+}
+
+func (r *msgpackReader) readFormat() (uint8, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// read a big-endian length of size 1, 2 or 4 bytes
+func (r *msgpackReader) readLength(size int) (int, error) {
+	b, err := r.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	}
+	return int(binary.BigEndian.Uint32(b)), nil
+}
+
+func (r *msgpackReader) readUint() (uint64, error) {
+	format, err := r.readFormat()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case format < 0x80:
+		return uint64(format), nil
+	case format >= 0xcc && format <= 0xcf:
+		b, err := r.next(1 << (format - 0xcc))
+		if err != nil {
+			return 0, err
+		}
+		return readBigEndian(b), nil
+	case format >= 0xd0 && format <= 0xd3:
+		b, err := r.next(1 << (format - 0xd0))
+		if err != nil {
+			return 0, err
+		}
+		// sign extend and reject negative values
+		shift := 64 - 8*len(b)
+		if v := int64(readBigEndian(b)<<shift) >> shift; v >= 0 {
+			return uint64(v), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: expected an unsigned integer, got format %#x", ErrTypeMismatch, format)
+}
+
+func readBigEndian(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func (r *msgpackReader) readUint16() (uint16, error) {
+	v, err := r.readUint()
+	if err != nil {
+		return 0, err
+	}
+	if v > math.MaxUint16 {
+		return 0, fmt.Errorf("%w: %d does not fit in a uint16", ErrTypeMismatch, v)
+	}
+	return uint16(v), nil
+}
+
+// read a str or bin, nil is returned for nil
+func (r *msgpackReader) readRaw() ([]byte, bool, error) {
+	format, err := r.readFormat()
+	if err != nil {
+		return nil, false, err
+	}
+	var n int
+	switch {
+	case format == 0xc0:
+		return nil, true, nil
+	case format >= 0xa0 && format <= 0xbf:
+		n = int(format & 0x1f)
+	case format == 0xc4 || format == 0xd9:
+		n, err = r.readLength(1)
+	case format == 0xc5 || format == 0xda:
+		n, err = r.readLength(2)
+	case format == 0xc6 || format == 0xdb:
+		n, err = r.readLength(4)
+	default:
+		return nil, false, fmt.Errorf("%w: expected str or bin, got format %#x", ErrTypeMismatch, format)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	b, err := r.next(n)
+	return b, false, err
+}
+
+func (r *msgpackReader) readString() (string, error) {
+	b, _, err := r.readRaw()
+	return string(b), err
+}
+
+func (r *msgpackReader) readBytes() ([]byte, error) {
+	b, isNil, err := r.readRaw()
+	if err != nil || isNil {
+		return nil, err
+	}
+	return append([]byte{}, b...), nil
+}
+
+// read the header of an array or map with the given fix and 16/32 bit formats
+func (r *msgpackReader) readContainer(fix uint8, fixMax uint8, format16, format32 uint8) (int, error) {
+	format, err := r.readFormat()
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	switch {
+	case format == 0xc0:
+		return 0, nil
+	case format >= fix && format <= fix|fixMax:
+		n = int(format & fixMax)
+	case format == format16:
+		n, err = r.readLength(2)
+	case format == format32:
+		n, err = r.readLength(4)
+	default:
+		return 0, fmt.Errorf("%w: unexpected format %#x", ErrTypeMismatch, format)
+	}
+	// every item takes at least one byte
+	if err == nil && n > len(r.b) {
+		err = fmt.Errorf("%w: %d items do not fit in %d bytes", ErrTruncated, n, len(r.b))
+	}
+	return n, err
+}
+
+func (r *msgpackReader) readMap() (int, error) {
+	return r.readContainer(0x80, 0x0f, 0xde, 0xdf)
+}
+
+func (r *msgpackReader) readArray() (int, error) {
+	return r.readContainer(0x90, 0x0f, 0xdc, 0xdd)
+}
+
+func (r *msgpackReader) readHeaders() (Headers, error) {
+	n, err := r.readArray()
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	headers := make(Headers, n)
+	for i := range headers {
+		entries, err := r.readMap()
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < entries; j++ {
+			key, err := r.readString()
+			if err != nil {
+				return nil, err
+			}
+			switch key {
+			case "key":
+				headers[i].Key, err = r.readString()
+			case "value":
+				headers[i].Value, err = r.readString()
+			default:
+				err = r.skip(1)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return headers, nil
+}
+
+// skip the next value, whatever its type
+func (r *msgpackReader) skip(depth int) error {
+	if depth > msgpackMaxDepth {
+		return fmt.Errorf("%w: values nested deeper than %d", ErrBadContent, msgpackMaxDepth)
+	}
+	format, err := r.readFormat()
+	if err != nil {
+		return err
+	}
+	var size, items int
+	switch {
+	case format < 0x80 || format >= 0xe0 || format == 0xc0 || format == 0xc2 || format == 0xc3:
+	case format <= 0x8f:
+		items = 2 * int(format&0x0f)
+	case format <= 0x9f:
+		items = int(format & 0x0f)
+	case format <= 0xbf:
+		size = int(format & 0x1f)
+	case format == 0xc4 || format == 0xd9:
+		size, err = r.readLength(1)
+	case format == 0xc5 || format == 0xda:
+		size, err = r.readLength(2)
+	case format == 0xc6 || format == 0xdb:
+		size, err = r.readLength(4)
+	case format >= 0xc7 && format <= 0xc9:
+		size, err = r.readLength(1 << (format - 0xc7))
+		size++ // ext type
+	case format == 0xca:
+		size = 4
+	case format == 0xcb:
+		size = 8
+	case format >= 0xcc && format <= 0xcf:
+		size = 1 << (format - 0xcc)
+	case format >= 0xd0 && format <= 0xd3:
+		size = 1 << (format - 0xd0)
+	case format >= 0xd4 && format <= 0xd8:
+		size = 1 + 1<<(format-0xd4)
+	case format == 0xdc:
+		items, err = r.readLength(2)
+	case format == 0xdd:
+		items, err = r.readLength(4)
+	case format == 0xde:
+		items, err = r.readLength(2)
+		items *= 2
+	case format == 0xdf:
+		items, err = r.readLength(4)
+		items *= 2
+	default:
+		return fmt.Errorf("%w: invalid format %#x", ErrBadContent, format)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := r.next(size); err != nil {
+		return err
+	}
+	if items > len(r.b) {
+		return fmt.Errorf("%w: %d items do not fit in %d bytes", ErrTruncated, items, len(r.b))
+	}
+	for i := 0; i < items; i++ {
+		if err := r.skip(depth + 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *msgpackReader) readTagged() (TaggedFields, error) {
+	n, err := r.readArray()
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	tagged := make(TaggedFields, n)
+	for i := range tagged {
+		entries, err := r.readMap()
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < entries; j++ {
+			key, err := r.readString()
+			if err != nil {
+				return nil, err
+			}
+			switch key {
+			case "tag":
+				tagged[i].Tag, err = r.readUint16()
+			case "value":
+				tagged[i].Value, err = r.readBytes()
+			default:
+				err = r.skip(1)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return tagged, nil
+}
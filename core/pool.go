@@ -0,0 +1,78 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"sync"
+)
+
+// Pools for the hot path. A request taken with AcquireRequest and released once it has been
+// processed reuses its serialisable, buffer and scratch memory, so producing, decoding with
+// DecodePayloadInto and releasing small payloads without headers does not allocate.
+
+// buffers that grew past this are dropped instead of being kept in the pool
+const maxPooledBufferSize = 1 << 20
+
+var serialisablePool = sync.Pool{
+	New: func() any {
+		return &Serialisable{buf: new(bytes.Buffer), Codec: &MessageCodec{}}
+	},
+}
+
+var requestPool = sync.Pool{
+	New: func() any { return new(Request) },
+}
+
+// get a serialisable from the pool configured with opts, return it with Release
+func AcquireSerialisable(opts ...SerialisableOpt) *Serialisable {
+	s := serialisablePool.Get().(*Serialisable)
+	s.pooled = true
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// return a serialisable from AcquireSerialisable to the pool, neither it nor the bytes of its
+// buffer may be used afterwards. Does nothing for serialisables from NewSerialisable.
+func (s *Serialisable) Release() {
+	if !s.pooled {
+		return
+	}
+	buf, codec := s.buf, s.Codec
+	*s = Serialisable{}
+	if buf == nil || buf.Cap() > maxPooledBufferSize {
+		buf = new(bytes.Buffer)
+	}
+	buf.Reset()
+	if mc, ok := codec.(*MessageCodec); ok {
+		*mc = MessageCodec{}
+	} else {
+		codec = &MessageCodec{}
+	}
+	s.buf, s.Codec = buf, codec
+	serialisablePool.Put(s)
+}
+
+// get a request from the pool with a pooled message configured with opts, Release returns both
+func AcquireRequest(id int, ctx context.Context, opts ...SerialisableOpt) *Request {
+	r := requestPool.Get().(*Request)
+	r.Id = id
+	r.Ctx = ctx
+	r.Message = AcquireSerialisable(opts...)
+	r.pooled = true
+	return r
+}
+
+// return a request from AcquireRequest and its message to their pools, neither may be used
+// afterwards. Does nothing for requests from NewRequest, so workers can release every request
+// they are done with.
+func (r *Request) Release() {
+	if !r.pooled {
+		return
+	}
+	r.Message.Release()
+	r.unstamp()
+	*r = Request{stamped: r.stamped}
+	requestPool.Put(r)
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// produce a pooled request, decode it into a reused payload and release it
+func pooledRoundTrip(producer *Producer, payload, decoded *Payload) error {
+	req, err := producer.NewRequest(1, payload, context.Background())
+	if err != nil {
+		return err
+	}
+	defer req.Release()
+	return req.Message.DecodePayloadInto(decoded)
+}
+
+func TestPooledRequests(t *testing.T) {
+	t.Run("test pooled round trip", func(t *testing.T) {
+		producer := NewProducer(WithPooledRequests(), WithPayloadTTL(time.Minute))
+		var decoded Payload
+		for i := 0; i < 3; i++ {
+			payload := newTestPayload(fmt.Sprintf("message %d", i))
+			if err := pooledRoundTrip(producer, payload, &decoded); err != nil {
+				t.Fatalf("round trip %d failed: %v", i, err)
+			}
+			if !bytes.Equal(decoded.Data, payload.Data) || !bytes.Equal(decoded.Identifier, payload.Identifier) {
+				t.Errorf("round trip %d: got %q from %q", i, decoded.Data, decoded.Identifier)
+			}
+			if decoded.Timestamp().IsZero() || decoded.TTL() != time.Minute {
+				t.Errorf("round trip %d: expected a timestamp and TTL, got %v", i, decoded.Tagged)
+			}
+			if payload.Tagged != nil {
+				t.Errorf("round trip %d: the caller's payload was stamped", i)
+			}
+		}
+	})
+
+	t.Run("test decoding into a payload reuses its memory", func(t *testing.T) {
+		s := NewSerialisable(WithFraming())
+		if err := s.EncodePayload(NewPayload(CurrentPayloadVersion, 1, []byte("id"), []byte("short"))); err != nil {
+			t.Fatal(err)
+		}
+		decoded := Payload{Data: make([]byte, 0, 64)}
+		data := decoded.Data[:1]
+		if err := s.DecodePayloadInto(&decoded); err != nil {
+			t.Fatal(err)
+		}
+		if string(decoded.Data) != "short" || &decoded.Data[0] != &data[0] {
+			t.Errorf("expected Data to be decoded into its old memory, got %q", decoded.Data)
+		}
+
+		s.InsertDataToSerialisableBuffer(s.buf.Bytes()[:s.buf.Len()-1])
+		if err := s.DecodePayloadInto(&decoded); err == nil {
+			t.Error("expected a truncated frame to fail")
+		}
+	})
+
+	t.Run("test released requests are reset", func(t *testing.T) {
+		req := AcquireRequest(7, context.Background(), WithFraming())
+		if err := req.AddPayload(NewPayload(CurrentPayloadVersion, 1, nil, []byte("data"))); err != nil {
+			t.Fatal(err)
+		}
+		req.Release()
+		if req.Message != nil || req.Ctx != nil || req.deadlineKnown {
+			t.Errorf("expected a released request to be reset, got %+v", req)
+		}
+
+		s := AcquireSerialisable()
+		if s.framed || s.buf.Len() != 0 || s.Codec.GetSchema() != nil {
+			t.Errorf("expected an acquired serialisable to start empty, got framed %v and %d bytes", s.framed, s.buf.Len())
+		}
+		s.Release()
+
+		// releasing requests that were not acquired does nothing
+		plain := NewRequest(1, NewSerialisable(), context.Background())
+		plain.Release()
+		if plain.Message == nil {
+			t.Error("expected a request from NewRequest to be left alone")
+		}
+	})
+
+	t.Run("test workers release processed requests", func(t *testing.T) {
+		producer := NewProducer(WithPooledRequests())
+		queue := make(RequestQueue, 1)
+		processed := make(chan string, 1)
+		dispatcher := NewDispatcher(1, 1)
+		dispatcher.AddQueue(queue)
+		dispatcher.Run(processorFunc(func(req *Request) error {
+			var payload Payload
+			if err := req.Message.DecodePayloadInto(&payload); err != nil {
+				return err
+			}
+			processed <- string(payload.Data)
+			return nil
+		}))
+
+		req, err := producer.NewRequest(1, NewPayload(CurrentPayloadVersion, 1, nil, []byte("data")), context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		queue <- req
+		select {
+		case data := <-processed:
+			if data != "data" {
+				t.Errorf("expected data, got %q", data)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("request was not processed")
+		}
+	})
+}
+
+// producing, decoding and releasing a small payload without headers must not allocate
+func TestPooledRequestAllocations(t *testing.T) {
+	producer := NewProducer(WithPooledRequests(), WithPayloadTTL(time.Minute))
+	payload := newTestPayload("Hello, World!")
+	var decoded Payload
+	if err := pooledRoundTrip(producer, payload, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := pooledRoundTrip(producer, payload, &decoded); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v per request", allocs)
+	}
+}
+
+func BenchmarkRequestLifecycle(b *testing.B) {
+	ctx := context.Background()
+	for _, size := range benchmarkSizes {
+		payload := benchmarkPayload(size)
+		b.Run(fmt.Sprintf("new/%dB", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			producer := NewProducer(WithPayloadTTL(time.Minute))
+			for i := 0; i < b.N; i++ {
+				req, err := producer.NewRequest(i, payload, ctx)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := req.Message.DecodePayload(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("pooled/%dB", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			producer := NewProducer(WithPooledRequests(), WithPayloadTTL(time.Minute))
+			var decoded Payload
+			for i := 0; i < b.N; i++ {
+				if err := pooledRoundTrip(producer, payload, &decoded); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// tagged field assigned by gewh, uint8 priority of the payload, higher is more urgent
+const TagPriority uint16 = 3
+
+// priority of the payload, zero when it has none
+func (p *Payload) Priority() uint8 {
+	return GetTaggedValue(p.Tagged, TagPriority, uint8(0))
+}
+
+// set the priority of the payload, zero removes it
+func (p *Payload) SetPriority(priority uint8) {
+	if priority == 0 {
+		p.DelTagged(TagPriority)
+		return
+	}
+	SetTaggedValue(p, TagPriority, priority)
+}
+
+// queue that hands out requests by their Priority instead of the order they arrive in. With
+// strict priority a request waits for every more urgent one, so a steady stream of urgent
+// requests starves the rest. With aging every aging a request waits counts as one level more
+// urgent, so low priority work still makes progress. Requests of the same effective priority
+// come out in the order they were pushed.
+type PriorityQueue struct {
+	mu    sync.Mutex
+	items requestHeap
+	ready chan struct{}    // signalled when a request is pushed
+	aging time.Duration    // zero for strict priority
+	seq   uint64           // push order, breaks ties
+	now   func() time.Time // clock, replaced in tests
+}
+
+type PriorityQueueOpt func(*PriorityQueue)
+
+// raise the effective priority of waiting requests by one level every aging
+func WithAging(aging time.Duration) PriorityQueueOpt {
+	return func(q *PriorityQueue) {
+		q.aging = aging
+	}
+}
+
+// creates a strict PriorityQueue with options
+func NewPriorityQueue(opts ...PriorityQueueOpt) *PriorityQueue {
+	q := &PriorityQueue{
+		ready: make(chan struct{}, 1),
+		now:   time.Now,
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
+}
+
+// add a request to the queue
+func (q *PriorityQueue) Push(req *Request) {
+	q.mu.Lock()
+	item := queuedRequest{req: req, seq: q.seq}
+	q.seq++
+	if q.aging > 0 {
+		// ordering by the push time moved back aging per level of priority is the same as
+		// ordering by the priority a request has aged to, and does not change while it waits
+		item.key = agedKey(q.now().UnixNano(), req.Priority, q.aging)
+	} else {
+		item.key = -int64(req.Priority)
+	}
+	heap.Push(&q.items, item)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// push time moved back aging per level of priority, saturating at the most urgent key instead
+// of wrapping around when a long aging moves it past the smallest int64
+func agedKey(pushed int64, priority uint8, aging time.Duration) int64 {
+	if priority == 0 {
+		return pushed
+	}
+	// room between pushed and the smallest key, pushed - math.MinInt64 fits in a uint64
+	room := uint64(pushed) + 1<<63
+	if uint64(aging) > room/uint64(priority) {
+		return math.MinInt64
+	}
+	return int64(uint64(pushed) - uint64(priority)*uint64(aging))
+}
+
+// remove the most urgent request, waiting for one until ctx is done
+func (q *PriorityQueue) Pop(ctx context.Context) (*Request, error) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			item := heap.Pop(&q.items).(queuedRequest)
+			more := len(q.items) > 0
+			q.mu.Unlock()
+			if more {
+				// pass the signal on for other callers waiting in Pop
+				select {
+				case q.ready <- struct{}{}:
+				default:
+				}
+			}
+			return item.req, nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// number of requests waiting
+func (q *PriorityQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+type queuedRequest struct {
+	req *Request
+	key int64 // smaller comes out first
+	seq uint64
+}
+
+// min-heap of queued requests, implements heap.Interface
+type requestHeap []queuedRequest
+
+func (h requestHeap) Len() int { return len(h) }
+
+func (h requestHeap) Less(i, j int) bool {
+	if h[i].key != h[j].key {
+		return h[i].key < h[j].key
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h requestHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *requestHeap) Push(x any) { *h = append(*h, x.(queuedRequest)) }
+
+func (h *requestHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = queuedRequest{}
+	*h = old[:len(old)-1]
+	return item
+}
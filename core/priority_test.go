@@ -0,0 +1,186 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func priorityRequest(id int, priority uint8) *Request {
+	return &Request{Id: id, Priority: priority}
+}
+
+// pop every request in the queue and return their ids
+func drain(t *testing.T, q *PriorityQueue) []int {
+	t.Helper()
+	var ids []int
+	for q.Len() > 0 {
+		req, err := q.Pop(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, req.Id)
+	}
+	return ids
+}
+
+func sameIds(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPriorityQueue(t *testing.T) {
+	t.Run("test strict priority", func(t *testing.T) {
+		q := NewPriorityQueue()
+		for i, priority := range []uint8{0, 5, 1, 5, 0} {
+			q.Push(priorityRequest(i, priority))
+		}
+		if got, want := drain(t, q), []int{1, 3, 2, 0, 4}; !sameIds(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("test waiting requests age", func(t *testing.T) {
+		now := time.Unix(0, 0)
+		q := NewPriorityQueue(WithAging(time.Second))
+		q.now = func() time.Time { return now }
+
+		q.Push(priorityRequest(1, 0))
+		now = now.Add(time.Second)
+		q.Push(priorityRequest(2, 2)) // urgent enough to overtake
+		now = now.Add(3 * time.Second)
+		q.Push(priorityRequest(3, 2)) // the first request has aged past it
+		if got, want := drain(t, q), []int{2, 1, 3}; !sameIds(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("test aging saturates", func(t *testing.T) {
+		now := time.Now()
+		q := NewPriorityQueue(WithAging(math.MaxInt64 / 2))
+		q.now = func() time.Time { return now }
+
+		// a boost past the smallest key makes a request the most urgent instead of wrapping
+		for i, priority := range []uint8{0, 255, 9} {
+			q.Push(priorityRequest(i, priority))
+		}
+		if got, want := drain(t, q), []int{1, 2, 0}; !sameIds(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("test pop waits for a request", func(t *testing.T) {
+		q := NewPriorityQueue()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := q.Pop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected Pop on an empty queue to wait for its context, got %v", err)
+		}
+
+		popped := make(chan *Request)
+		go func() {
+			req, _ := q.Pop(context.Background())
+			popped <- req
+		}()
+		q.Push(priorityRequest(7, 0))
+		select {
+		case req := <-popped:
+			if req.Id != 7 {
+				t.Errorf("expected request 7, got %d", req.Id)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Pop was not woken up by Push")
+		}
+	})
+
+	t.Run("test requests take the priority of their payload", func(t *testing.T) {
+		payload := NewPayload(CurrentPayloadVersion, 1, nil, []byte("urgent"))
+		payload.SetPriority(9)
+		req := NewRequest(1, NewSerialisable(), context.Background())
+		if err := req.AddPayload(payload); err != nil {
+			t.Fatal(err)
+		}
+		if req.Priority != 9 {
+			t.Errorf("expected priority 9, got %d", req.Priority)
+		}
+		decoded, _ := req.Message.DecodePayload()
+		if decoded.Priority() != 9 {
+			t.Errorf("expected the priority to be encoded, got %d", decoded.Priority())
+		}
+		payload.SetPriority(0)
+		if payload.Tagged != nil {
+			t.Errorf("expected priority 0 to remove the tag, got %v", payload.Tagged)
+		}
+	})
+}
+
+func TestDispatcherPriorityQueue(t *testing.T) {
+	ctx := context.Background()
+	producer := NewProducer()
+	newRequest := func(id int, priority uint8) *Request {
+		payload := NewPayload(CurrentPayloadVersion, 1, nil, []byte("data"))
+		payload.SetPriority(priority)
+		req, err := producer.NewRequest(id, payload, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	started := make(chan struct{})
+	busy := make(chan struct{})
+	order := make(chan int, 4)
+	recorder := processorFunc(func(req *Request) error {
+		if req.Id == 0 {
+			close(started)
+			<-busy
+		}
+		order <- req.Id
+		return nil
+	})
+
+	priority := NewPriorityQueue()
+	dispatcher := NewDispatcher(1, 1)
+	dispatcher.AddQueue(make(RequestQueue, 4))
+	dispatcher.AddPriorityQueue(priority)
+	dispatcher.Run(recorder)
+	producer.Subscribe(dispatcher)
+
+	// the only worker is kept busy while the rest queue up
+	futures := []*Future{producer.Publish(ctx, newRequest(0, 0))}
+	<-started
+	for id, p := range []uint8{0, 9, 1} {
+		futures = append(futures, producer.Publish(ctx, newRequest(id+1, p)))
+	}
+	deadline := time.Now().Add(time.Second)
+	for priority.Len() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 3 requests in the priority queue, got %d", priority.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(busy)
+
+	for _, future := range futures {
+		if _, err := waitFuture(t, future); err != nil {
+			t.Fatalf("expected every request to be processed, got %v", err)
+		}
+	}
+	close(order)
+	var got []int
+	for id := range order {
+		got = append(got, id)
+	}
+	if want := []int{0, 2, 3, 1}; !sameIds(got, want) {
+		t.Errorf("expected requests to be processed in order %v, got %v", want, got)
+	}
+}
@@ -17,6 +17,11 @@ type Producer struct {
 	subs             map[uint64]*Dispatcher
 	doneListener     chan uint64
 	broadcastTimeout time.Duration
+	serialisableOpts []SerialisableOpt // options for the messages created by NewRequest
+	signingKeys      *KeyRing          // signs the payloads of requests created by NewRequest when set
+	ttl              time.Duration     // how long payloads created by NewRequest stay valid, zero for ever
+	pooled           bool              // NewRequest takes requests from the pool
+	errorsOnly       bool              // futures of Publish resolve without the processed payload
 }
 
 type ProducerOpt func(*Producer)
@@ -27,6 +32,55 @@ func WithBroadcastTimeout[T any](timeout time.Duration) ProducerOpt {
 	}
 }
 
+// compress the Data of payloads created by NewRequest, CompressionNone turns it off
+func WithPayloadCompression(compression Compression, threshold int) ProducerOpt {
+	return func(ep *Producer) {
+		ep.serialisableOpts = append(ep.serialisableOpts, WithCompression(compression, threshold))
+	}
+}
+
+// encode payloads created by NewRequest as the given content type
+func WithPayloadContentType(content ContentType) ProducerOpt {
+	return func(ep *Producer) {
+		ep.serialisableOpts = append(ep.serialisableOpts, WithContentType(content))
+	}
+}
+
+// encrypt the Data of payloads created by NewRequest with the key of their client
+func WithPayloadEncryption(keys KeyProvider) ProducerOpt {
+	return func(ep *Producer) {
+		ep.serialisableOpts = append(ep.serialisableOpts, WithEncryption(keys))
+	}
+}
+
+// sign the payloads of requests created by NewRequest with the current key of the ring
+func WithSigning(ring *KeyRing) ProducerOpt {
+	return func(ep *Producer) {
+		ep.signingKeys = ring
+	}
+}
+
+// expire payloads created by NewRequest ttl after they were created, unless they have a TTL
+func WithPayloadTTL(ttl time.Duration) ProducerOpt {
+	return func(ep *Producer) {
+		ep.ttl = ttl
+	}
+}
+
+// take the requests created by NewRequest from a pool, workers return them once processed
+func WithPooledRequests() ProducerOpt {
+	return func(ep *Producer) {
+		ep.pooled = true
+	}
+}
+
+// resolve the futures of Publish with errors only, saving a copy of every processed payload
+func WithoutResultPayloads() ProducerOpt {
+	return func(ep *Producer) {
+		ep.errorsOnly = true
+	}
+}
+
 // creates new producer with options
 func NewProducer(opts ...ProducerOpt) *Producer {
 	producer := &Producer{
@@ -59,6 +113,34 @@ func (ep *Producer) Start(ctx context.Context) {
 	}
 }
 
+// creates a request for the payload, encoded with the options of the producer
+func (ep *Producer) NewRequest(id int, payload *Payload, ctx context.Context) (*Request, error) {
+	var req *Request
+	if ep.pooled {
+		req = AcquireRequest(id, ctx, ep.serialisableOpts...)
+	} else {
+		req = NewRequest(id, NewSerialisable(ep.serialisableOpts...), ctx)
+	}
+	payload = req.stamp(payload, ep.ttl)
+	if ep.signingKeys != nil {
+		// sign a copy so the headers of the caller's payload are left alone
+		signed := *payload
+		signed.Headers = append(Headers(nil), payload.Headers...)
+		if err := SignPayload(&signed, ep.signingKeys); err != nil {
+			req.Release()
+			return nil, err
+		}
+		payload = &signed
+	}
+	err := req.AddPayload(payload)
+	req.unstamp()
+	if err != nil {
+		req.Release()
+		return nil, err
+	}
+	return req, nil
+}
+
 // Dispatcher subcribes to Producer, listens to requests emitted by Producer
 func (ep *Producer) Subscribe(dp *Dispatcher) {
 	ep.Lock()
@@ -66,23 +148,52 @@ func (ep *Producer) Subscribe(dp *Dispatcher) {
 	ep.subs[dp.id] = dp
 }
 
+// send the request to every subscribed dispatcher, waiting at most the broadcast timeout for each
 func (ep *Producer) Broadcast(ctx context.Context, req *Request) {
 	ep.RLock()
 	defer ep.RUnlock()
+	ep.deliver(ctx, req, nil)
+}
+
+// send the request to every subscribed dispatcher like Broadcast and return a future that
+// resolves with the outcome at each of them
+func (ep *Producer) Publish(ctx context.Context, req *Request) *Future {
+	ep.RLock()
+	defer ep.RUnlock()
+	future := newFuture(len(ep.subs), !ep.errorsOnly)
+	ep.deliver(ctx, req, future)
+	return future
+}
+
+// every dispatcher gets a copy of the request but the first, so they can process and release
+// their requests independently. The copies are made up front since a dispatcher may release
+// the request as soon as it has it. The caller holds the read lock.
+func (ep *Producer) deliver(ctx context.Context, req *Request, future *Future) {
+	requests := make(map[uint64]*Request, len(ep.subs))
+	for id := range ep.subs {
+		sent := req
+		if len(requests) > 0 {
+			sent = req.clone()
+		}
+		sent.future, sent.subscriber = future, id
+		requests[id] = sent
+	}
 	var wg sync.WaitGroup
-	for _, sub := range ep.subs {
+	for id, sub := range ep.subs {
 		wg.Add(1)
-		go func(listener *Dispatcher, w *sync.WaitGroup) {
+		go func(listener *Dispatcher, req *Request, w *sync.WaitGroup) {
 			defer w.Done()
 			select {
 			case listener.queue <- req:
 				fmt.Println("Request sent to queue")
 			case <-time.After(ep.broadcastTimeout):
 				fmt.Println("Broadcast to listener timed out.")
+				req.fail(fmt.Errorf("%w %d: timed out", ErrNotDelivered, listener.id))
 			case <-ctx.Done():
 				fmt.Println("Context cancelled")
+				req.fail(ctx.Err())
 			}
-		}(sub, &wg)
+		}(sub, requests[id], &wg)
 	}
 	wg.Wait() // Wait for all goroutines to complete
 }
@@ -0,0 +1,211 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// version of the Payload layout that processors expect
+const CurrentPayloadVersion uint16 = 2
+
+// registry used by serialisables that have no registry of their own
+var DefaultCodecRegistry = NewCodecRegistry(CurrentPayloadVersion)
+
+func init() {
+	DefaultCodecRegistry.Register(1, PayloadSchemaV1)
+	DefaultCodecRegistry.Register(2, PayloadSchema)
+	// version 2 only adds headers and the tagged section, which version 1 payloads leave empty
+	DefaultCodecRegistry.RegisterUpgrade(1, func(p *Payload) error {
+		p.Version = 2
+		return nil
+	})
+}
+
+// turns a payload of one version into the shape of the next version, it must advance payload.Version
+type UpgradeFunc func(*Payload) error
+
+// maps wire versions to their layouts so messages of different versions can share a queue
+type CodecRegistry struct {
+	sync.RWMutex
+	schemas  map[uint16]Schema      // layout of each known version
+	native   map[uint16]bool        // versions whose layout Payload can encode without reflection
+	upgrades map[uint16]UpgradeFunc // upgrade hook from a version to the next one
+	current  uint16                 // version every decoded payload is upgraded to
+}
+
+// creates a registry that upgrades decoded payloads to the current version
+func NewCodecRegistry(current uint16) *CodecRegistry {
+	return &CodecRegistry{
+		schemas:  make(map[uint16]Schema),
+		native:   make(map[uint16]bool),
+		upgrades: make(map[uint16]UpgradeFunc),
+		current:  current,
+	}
+}
+
+// register the layout used by a version, the first field of every layout has to be the uint16 Version
+func (r *CodecRegistry) Register(version uint16, schema Schema) {
+	r.Lock()
+	defer r.Unlock()
+	r.schemas[version] = schema
+	r.native[version] = reflect.DeepEqual(schema, payloadSchemaFor(version))
+}
+
+// register the hook that upgrades payloads of version from
+func (r *CodecRegistry) RegisterUpgrade(from uint16, fn UpgradeFunc) {
+	r.Lock()
+	defer r.Unlock()
+	r.upgrades[from] = fn
+}
+
+// get the layout of a version
+func (r *CodecRegistry) Schema(version uint16) (Schema, error) {
+	r.RLock()
+	defer r.RUnlock()
+	schema, ok := r.schemas[version]
+	if !ok {
+		return nil, fmt.Errorf("%w %d", ErrUnknownVersion, version)
+	}
+	return schema, nil
+}
+
+// can payloads of this version use the reflection-free encoding
+func (r *CodecRegistry) isNative(version uint16) bool {
+	r.RLock()
+	defer r.RUnlock()
+	return r.native[version]
+}
+
+// version every decoded payload is upgraded to
+func (r *CodecRegistry) Current() uint16 {
+	return r.current
+}
+
+// decode the buffer of the serialisable with the layout of the version it was written with
+func (r *CodecRegistry) Decode(s *Serialisable) (ByteFields, error) {
+	_, body, err := s.body()
+	if err != nil {
+		return nil, err
+	}
+	version, err := peekVersion(body)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := r.Schema(version)
+	if err != nil {
+		return nil, err
+	}
+	return decodeFields(newLimitedFieldDecoder(body, s.limits), schema)
+}
+
+// decode the serialisable into a payload upgraded to the current version
+func (r *CodecRegistry) DecodePayload(s *Serialisable) (*Payload, error) {
+	payload := &Payload{}
+	if err := r.decodePayloadInto(s, payload, copyBytes); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// decode the serialisable into payload, mode decides how binary payloads fill the byte fields
+func (r *CodecRegistry) decodePayloadInto(s *Serialisable, payload *Payload, mode byteMode) error {
+	if err := r.decodeOriginal(s, payload, mode); err != nil {
+		return err
+	}
+	return r.Upgrade(payload)
+}
+
+// decode the payload with its Data decrypted and decompressed, keeping the version it was encoded with
+func (r *CodecRegistry) decodeOriginal(s *Serialisable, payload *Payload, mode byteMode) error {
+	header, err := r.decodeEncoded(s, payload, mode)
+	if err != nil {
+		return err
+	}
+	if header.Flags&flagEncrypted != 0 {
+		if err := decryptPayload(payload, s.keys); err != nil {
+			return err
+		}
+	}
+	payload.Data, err = compressionFromFlags(header.Flags).decompress(payload.Data, s.limits.orDefault().MaxFieldSize)
+	return err
+}
+
+// decode the payload as it was encoded, its Data is left encrypted and compressed
+func (r *CodecRegistry) decodeEncoded(s *Serialisable, payload *Payload, mode byteMode) (FrameHeader, error) {
+	header, body, err := s.body()
+	if err != nil {
+		return header, err
+	}
+	if header.ContentType != ContentBinary {
+		codec, err := LookupContentCodec(header.ContentType)
+		if err != nil {
+			return header, err
+		}
+		if err := codec.DecodePayload(body, payload); err != nil {
+			return header, err
+		}
+		// the binary layout cannot hold headers before version 2, other encodings must not either
+		if err := payload.checkVersion(); err != nil {
+			return header, err
+		}
+		if err := s.limits.orDefault().checkPayload(payload); err != nil {
+			return header, err
+		}
+	} else if err := r.decodeBinary(s, body, payload, mode); err != nil {
+		return header, err
+	}
+	return header, payload.Tagged.check()
+}
+
+// decode a binary body with the layout registered for its version
+func (r *CodecRegistry) decodeBinary(s *Serialisable, body []byte, payload *Payload, mode byteMode) error {
+	version, err := peekVersion(body)
+	if err != nil {
+		return err
+	}
+	if r.isNative(version) {
+		if err := payload.unmarshalBinary(body, mode); err != nil {
+			return err
+		}
+		return s.limits.orDefault().checkPayload(payload)
+	}
+	schema, err := r.Schema(version)
+	if err != nil {
+		return err
+	}
+	fields, err := decodeFields(newLimitedFieldDecoder(body, s.limits), schema)
+	if err != nil {
+		return err
+	}
+	return payload.FromFields(fields)
+}
+
+// run the upgrade hooks until the payload reaches the current version
+func (r *CodecRegistry) Upgrade(payload *Payload) error {
+	for payload.Version < r.current {
+		r.RLock()
+		upgrade, ok := r.upgrades[payload.Version]
+		r.RUnlock()
+		if !ok {
+			return fmt.Errorf("no upgrade registered from version %d", payload.Version)
+		}
+		from := payload.Version
+		if err := upgrade(payload); err != nil {
+			return fmt.Errorf("upgrading from version %d: %w", from, err)
+		}
+		if payload.Version <= from {
+			return fmt.Errorf("%w: from version %d", ErrUpgradeFailed, from)
+		}
+	}
+	return nil
+}
+
+// read the version from the start of an encoded message
+func peekVersion(body []byte) (uint16, error) {
+	if len(body) < 2 {
+		return 0, fmt.Errorf("%w: %d bytes is too short to hold a version", ErrTruncated, len(body))
+	}
+	return binary.LittleEndian.Uint16(body), nil
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// version 1 of this layout had no identifier, version 2 added it
+func newTestRegistry() *CodecRegistry {
+	registry := NewCodecRegistry(2)
+	registry.Register(1, Schema{
+		{Name: "Version", Kind: KindUint16},
+		{Name: "ClientId", Kind: KindUint16},
+		{Name: "Data", Kind: KindBytes},
+	})
+	registry.Register(2, PayloadSchema)
+	registry.RegisterUpgrade(1, func(p *Payload) error {
+		p.Identifier = []byte("legacy")
+		p.Version = 2
+		return nil
+	})
+	return registry
+}
+
+func TestCodecRegistry(t *testing.T) {
+	t.Run("test decoding mixed versions from the same queue", func(t *testing.T) {
+		registry := newTestRegistry()
+		queue := make(RequestQueue, 2)
+		for _, payload := range []*Payload{
+			NewPayload(1, 1, nil, []byte("old")),
+			NewPayload(2, 2, []byte("origin"), []byte("new")),
+		} {
+			req := NewRequest(int(payload.ClientId), NewSerialisable(WithCodecRegistry(registry)), context.Background())
+			if err := req.AddPayload(payload); err != nil {
+				t.Fatalf("encoding failed: %v", err)
+			}
+			queue <- req
+		}
+		close(queue)
+
+		want := []Payload{
+			{Version: 2, ClientId: 1, Identifier: []byte("legacy"), Data: []byte("old")},
+			{Version: 2, ClientId: 2, Identifier: []byte("origin"), Data: []byte("new")},
+		}
+		i := 0
+		for req := range queue {
+			// fresh serialisable so that only the wire bytes are used
+			received := NewSerialisable(WithCodecRegistry(registry))
+			received.InsertDataToSerialisableBuffer(req.Message.buf.Bytes())
+			got, err := received.DecodePayload()
+			if err != nil {
+				t.Fatalf("decoding failed: %v", err)
+			}
+			if !reflect.DeepEqual(*got, want[i]) {
+				t.Errorf("payload mismatch: got %v, want %v", *got, want[i])
+			}
+			i++
+		}
+	})
+
+	t.Run("test unknown version", func(t *testing.T) {
+		s := NewSerialisable(WithCodecRegistry(newTestRegistry()))
+		s.InsertDataToSerialisableBuffer([]byte{0x09, 0x00, 0x01, 0x00})
+		if _, err := s.DecodePayload(); !errors.Is(err, ErrUnknownVersion) {
+			t.Errorf("expected ErrUnknownVersion, got %v", err)
+		}
+	})
+
+	t.Run("test upgrade that does not advance the version", func(t *testing.T) {
+		registry := newTestRegistry()
+		registry.RegisterUpgrade(1, func(p *Payload) error { return nil })
+		if err := registry.Upgrade(NewPayload(1, 1, nil, nil)); !errors.Is(err, ErrUpgradeFailed) {
+			t.Errorf("expected ErrUpgradeFailed, got %v", err)
+		}
+	})
+
+	t.Run("test default registry decodes current payloads", func(t *testing.T) {
+		req := createAndFormatTestRequest(newTestPayload("data"), 1, context.Background())
+		got, err := req.Message.DecodePayload()
+		if err != nil {
+			t.Fatalf("decoding failed: %v", err)
+		}
+		if got.ClientId != 42 || string(got.Data) != "data" {
+			t.Errorf("payload mismatch: got %v", got)
+		}
+	})
+}
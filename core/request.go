@@ -3,34 +3,118 @@ package core
 import (
 	"context"
 	"log"
+	"time"
 )
 
 // request is the format that our serialisable messages are going to be sent as to the message broker.
 type Request struct {
-	Id      int             // id of the request
-	Message *Serialisable   // message of serialisable form.
-	Ctx     context.Context // context to keep track of cancelled requests and remove from the message broker.
+	Id       int             // id of the request
+	Message  *Serialisable   // message of serialisable form.
+	Ctx      context.Context // context to keep track of cancelled requests and remove from the message broker.
+	Priority uint8           // dispatch order in a PriorityQueue, higher first, taken from the payload by AddPayload
+
+	deadline      time.Time // when the payload expires, zero when it does not
+	deadlineKnown bool      // deadline has been read from the payload
+	pooled        bool      // taken with AcquireRequest, Release returns it to the pool
+	future        *Future   // resolved with the outcome when the request was published
+	subscriber    uint64    // id of the dispatcher a published request was sent to
+	attempts      []Attempt // failed attempts at processing
+	failure       error     // why the request was dead-lettered
+	admitted      bool      // passed the stages of its dispatcher, which are reverted when it fails
+	stamped       struct {
+		payload Payload  // copy of the payload being encoded, with its timestamp and TTL
+		values  [16]byte // timestamp and TTL values of payload
+	}
 }
 
 // creates new request
 func NewRequest(id int, message *Serialisable, ctx context.Context) *Request {
 	return &Request{
-		id,
-		message,
-		ctx,
+		Id:      id,
+		Message: message,
+		Ctx:     ctx,
+	}
+}
+
+// encode payload into the message of the request
+func (r *Request) AddPayload(payload *Payload) error {
+	if err := r.Message.EncodePayload(payload); err != nil {
+		return err
 	}
+	r.setDeadline(payload)
+	r.Priority = payload.Priority()
+	return nil
 }
 
-func (r *Request) AddPayload(payload *Payload) {
-	fields := payload.ToFields()
-	r.Message.Codec.AddFields(fields)
-	r.Message.Encode()
+// decode the headers of the request's payload, for routing without processing the data. Data
+// is not decrypted or decompressed, so brokers without the client's key can route it.
+func (r *Request) Headers() (Headers, error) {
+	payload, err := r.Message.PeekPayload()
+	if err != nil {
+		return nil, err
+	}
+	return payload.Headers, nil
 }
 
 type DataProcessor interface {
 	Process(*Request) error
 }
 
+// processor that can be stopped part way through. ctx is done when the request is cancelled or
+// its payload expires, the processor should then give up and return ctx.Err().
+type ContextProcessor interface {
+	ProcessContext(context.Context, *Request) error
+}
+
+// function implementing both DataProcessor and ContextProcessor
+type ContextProcessorFunc func(context.Context, *Request) error
+
+func (fn ContextProcessorFunc) ProcessContext(ctx context.Context, req *Request) error {
+	return fn(ctx, req)
+}
+
+// process with the context of the request
+func (fn ContextProcessorFunc) Process(req *Request) error {
+	ctx := req.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return fn(ctx, req)
+}
+
+// ContextProcessor for p. Processors without ProcessContext are not started once ctx is done,
+// but run to completion once they are.
+func AdaptProcessor(p DataProcessor) ContextProcessor {
+	if cp, ok := p.(ContextProcessor); ok {
+		return cp
+	}
+	return processorAdapter{p}
+}
+
+type processorAdapter struct {
+	DataProcessor
+}
+
+func (a processorAdapter) ProcessContext(ctx context.Context, req *Request) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.Process(req)
+}
+
+// context for processing the request, done when the request is cancelled or its payload expires.
+// The cause of a context done by the payload deadline is ErrExpired.
+func (r *Request) processingContext() (context.Context, context.CancelFunc) {
+	ctx := r.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if deadline, err := r.Deadline(); err == nil && !deadline.IsZero() {
+		return context.WithDeadlineCause(ctx, deadline, ErrExpired)
+	}
+	return context.WithCancel(ctx)
+}
+
 type MockDataProcessingFn func([]byte) []byte
 
 func (fn MockDataProcessingFn) modifyDataField(field []byte) []byte {
@@ -39,21 +123,14 @@ func (fn MockDataProcessingFn) modifyDataField(field []byte) []byte {
 
 // request processing, currently needs even an empty function should be changed.
 func (fn MockDataProcessingFn) Process(req *Request) error {
-	// decoding current message into byte fields given the codec that is attached to the message
-	decodedByteFields, err := req.Message.Decode()
+	// decoding current message into a payload of the current version
+	decodedPayload, err := req.Message.DecodePayload()
 	if err != nil {
 		log.Printf("Could not decode data on request:%v , error: %v", req.Id, err)
 		return err
 	}
-	// create empty payload and populate it with the decoded bytefields
-	decodedPayload := Payload{}
-	decodedPayload.FromFields(decodedByteFields)
 	// Processing of message
 	decodedPayload.Data = fn.modifyDataField(decodedPayload.Data)
-	// back to byte fields
-	modifiedByteFields := decodedPayload.ToFields()
-	req.Message.Codec.AddFields(modifiedByteFields)
-	// encode
-	req.Message.Encode()
-	return nil
+	// encode back into the message
+	return req.Message.EncodePayload(decodedPayload)
 }
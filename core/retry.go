@@ -0,0 +1,134 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// retry defaults of NewRetryPolicy
+const (
+	DefaultMaxAttempts = 3
+	DefaultBaseDelay   = 100 * time.Millisecond
+	DefaultMaxDelay    = 10 * time.Second
+	DefaultJitter      = 0.2
+)
+
+// failed attempt at processing a request
+type Attempt struct {
+	At  time.Time // when processing returned
+	Err error     // error of the processor
+}
+
+// how a dispatcher retries requests its processor fails on. The delay before attempt n+1 is
+// baseDelay doubled n-1 times, capped at maxDelay, and shortened by up to jitter of itself so
+// requests that failed together are not retried together.
+type RetryPolicy struct {
+	maxAttempts int              // attempts including the first
+	baseDelay   time.Duration    // delay before the second attempt
+	maxDelay    time.Duration    // longest delay, unbounded when zero
+	jitter      float64          // fraction of the delay that is randomised, 0 to 1
+	retryable   func(error) bool // classifies errors worth another attempt
+	random      func() float64   // source of jitter in [0, 1), replaced in tests
+}
+
+type RetryOpt func(*RetryPolicy)
+
+// give up on a request after attempts, including the first
+func WithMaxAttempts(attempts int) RetryOpt {
+	return func(p *RetryPolicy) {
+		p.maxAttempts = attempts
+	}
+}
+
+// wait base before the second attempt, doubling for every attempt after up to max
+func WithBackoff(base, max time.Duration) RetryOpt {
+	return func(p *RetryPolicy) {
+		p.baseDelay = base
+		p.maxDelay = max
+	}
+}
+
+// shorten every delay by a random fraction of up to jitter, zero waits the exact delay
+func WithJitter(jitter float64) RetryOpt {
+	return func(p *RetryPolicy) {
+		p.jitter = min(max(jitter, 0), 1)
+	}
+}
+
+// retry only errors fn returns true for, DefaultRetryable is used otherwise
+func WithRetryable(fn func(error) bool) RetryOpt {
+	return func(p *RetryPolicy) {
+		p.retryable = fn
+	}
+}
+
+// creates a RetryPolicy with the defaults and options
+func NewRetryPolicy(opts ...RetryOpt) *RetryPolicy {
+	p := &RetryPolicy{
+		maxAttempts: DefaultMaxAttempts,
+		baseDelay:   DefaultBaseDelay,
+		maxDelay:    DefaultMaxDelay,
+		jitter:      DefaultJitter,
+		retryable:   DefaultRetryable,
+		random:      rand.Float64,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// retries every error except those of cancelled or expired requests, which would fail again.
+// Requests stopped by the Timeout middleware are retried.
+func DefaultRetryable(err error) bool {
+	if errors.Is(err, ErrTimeout) {
+		return true
+	}
+	return !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded) &&
+		!errors.Is(err, ErrExpired)
+}
+
+// delay before the attempt after the given number of failed ones
+func (p *RetryPolicy) Backoff(failed int) time.Duration {
+	delay := p.baseDelay
+	for i := 1; i < failed; i++ {
+		if p.maxDelay > 0 && delay >= p.maxDelay || delay > math.MaxInt64/2 {
+			break
+		}
+		delay *= 2
+	}
+	if p.maxDelay > 0 && delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	if p.jitter > 0 {
+		delay -= time.Duration(p.jitter * p.random() * float64(delay))
+	}
+	return delay
+}
+
+// why a request that failed on its last attempt is given up on, nil when it should be retried
+func (p *RetryPolicy) giveUp(err error, attempts int) error {
+	if p.retryable != nil && !p.retryable(err) {
+		return fmt.Errorf("%w: %w", ErrNotRetryable, err)
+	}
+	if attempts >= p.maxAttempts {
+		return fmt.Errorf("%w: %d attempts: %w", ErrRetriesExhausted, attempts, err)
+	}
+	return nil
+}
+
+// failed attempts at processing the request, recorded by dispatchers with a retry policy or a
+// dead letter queue
+func (r *Request) Attempts() []Attempt {
+	return r.attempts
+}
+
+// why the request was sent to a dead letter queue, nil when it was not
+func (r *Request) Failure() error {
+	return r.failure
+}
@@ -0,0 +1,188 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	t.Run("test backoff doubles up to the maximum", func(t *testing.T) {
+		p := NewRetryPolicy(WithBackoff(10*time.Millisecond, 50*time.Millisecond), WithJitter(0))
+		want := []time.Duration{10, 20, 40, 50, 50}
+		for i, delay := range want {
+			if got := p.Backoff(i + 1); got != delay*time.Millisecond {
+				t.Errorf("expected %v after %d failed attempts, got %v", delay*time.Millisecond, i+1, got)
+			}
+		}
+		if got := NewRetryPolicy(WithBackoff(time.Second, 0), WithJitter(0)).Backoff(100); got <= 0 {
+			t.Errorf("expected an unbounded backoff not to overflow, got %v", got)
+		}
+	})
+
+	t.Run("test jitter shortens the delay", func(t *testing.T) {
+		p := NewRetryPolicy(WithBackoff(100*time.Millisecond, 0), WithJitter(0.5))
+		p.random = func() float64 { return 0.5 }
+		if got := p.Backoff(1); got != 75*time.Millisecond {
+			t.Errorf("expected 75ms, got %v", got)
+		}
+		p.random = func() float64 { return 0 }
+		if got := p.Backoff(1); got != 100*time.Millisecond {
+			t.Errorf("expected 100ms, got %v", got)
+		}
+	})
+
+	t.Run("test requests are given up on", func(t *testing.T) {
+		failure := errors.New("failed")
+		p := NewRetryPolicy(WithMaxAttempts(2))
+		if err := p.giveUp(failure, 1); err != nil {
+			t.Errorf("expected a retry, got %v", err)
+		}
+		if err := p.giveUp(failure, 2); !errors.Is(err, ErrRetriesExhausted) || !errors.Is(err, failure) {
+			t.Errorf("expected ErrRetriesExhausted, got %v", err)
+		}
+		if err := p.giveUp(ErrExpired, 1); !errors.Is(err, ErrNotRetryable) || !errors.Is(err, ErrExpired) {
+			t.Errorf("expected expired requests not to be retried, got %v", err)
+		}
+		p = NewRetryPolicy(WithRetryable(func(err error) bool { return !errors.Is(err, failure) }))
+		if err := p.giveUp(failure, 1); !errors.Is(err, ErrNotRetryable) {
+			t.Errorf("expected the classifier to be used, got %v", err)
+		}
+	})
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	failure := errors.New("processing failed")
+	run := func(p DataProcessor, deadLetter RequestQueue, opts ...RetryOpt) (*Producer, *Dispatcher) {
+		producer := NewProducer(WithoutResultPayloads())
+		dispatcher := NewDispatcher(1, 1)
+		dispatcher.AddQueue(make(RequestQueue, 1))
+		opts = append([]RetryOpt{WithMaxAttempts(3), WithBackoff(time.Millisecond, 5*time.Millisecond)}, opts...)
+		dispatcher.AddRetryPolicy(NewRetryPolicy(opts...))
+		dispatcher.AddDeadLetterQueue(deadLetter)
+		// deduplication must not reject retried or replayed requests
+		dispatcher.AddStage(NewDeduplicator())
+		dispatcher.Run(p)
+		producer.Subscribe(dispatcher)
+		return producer, dispatcher
+	}
+	var publishWith func(t *testing.T, producer *Producer, reqCtx context.Context, identifier string) error
+	publish := func(t *testing.T, producer *Producer) error {
+		t.Helper()
+		return publishWith(t, producer, context.Background(), "batch-1")
+	}
+	publishWith = func(t *testing.T, producer *Producer, reqCtx context.Context, identifier string) error {
+		t.Helper()
+		req, _ := producer.NewRequest(1, NewPayload(CurrentPayloadVersion, 1, []byte(identifier), []byte("data")), reqCtx)
+		_, err := waitFuture(t, producer.Publish(context.Background(), req))
+		return err
+	}
+
+	t.Run("test failed requests are retried", func(t *testing.T) {
+		var calls atomic.Int32
+		producer, dispatcher := run(processorFunc(func(*Request) error {
+			if calls.Add(1) < 3 {
+				return failure
+			}
+			return nil
+		}), nil)
+		if err := publish(t, producer); err != nil {
+			t.Errorf("expected the last attempt to succeed, got %v", err)
+		}
+		if stats := dispatcher.Stats(); stats.Retries != 2 || stats.DeadLettered != 0 {
+			t.Errorf("expected 2 retries, got %+v", stats)
+		}
+	})
+
+	t.Run("test requests are dead-lettered and replayed", func(t *testing.T) {
+		var fixed atomic.Bool
+		var calls atomic.Int32
+		deadLetter := make(RequestQueue, 1)
+		producer, dispatcher := run(processorFunc(func(*Request) error {
+			calls.Add(1)
+			if !fixed.Load() {
+				return failure
+			}
+			return nil
+		}), deadLetter)
+		if err := publish(t, producer); !errors.Is(err, ErrRetriesExhausted) || !errors.Is(err, failure) {
+			t.Errorf("expected the future to resolve with the failure, got %v", err)
+		}
+
+		req := <-deadLetter
+		if !errors.Is(req.Failure(), ErrRetriesExhausted) {
+			t.Errorf("expected the failure reason to be attached, got %v", req.Failure())
+		}
+		attempts := req.Attempts()
+		if len(attempts) != 3 || !errors.Is(attempts[2].Err, failure) || attempts[2].At.Before(attempts[0].At) {
+			t.Errorf("expected the history of 3 attempts, got %+v", attempts)
+		}
+		if stats := dispatcher.Stats(); stats.Retries != 2 || stats.DeadLettered != 1 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+
+		fixed.Store(true)
+		deadLetter <- req
+		if replayed := dispatcher.ReplayDeadLetters(); replayed != 1 {
+			t.Fatalf("expected 1 request to be replayed, got %d", replayed)
+		}
+		deadline := time.Now().Add(time.Second)
+		for calls.Load() < 4 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if calls.Load() != 4 {
+			t.Errorf("expected the replayed request to be processed, %d calls", calls.Load())
+		}
+		if req.Failure() != nil || req.Attempts() != nil {
+			t.Error("expected replay to clear the failure and attempts")
+		}
+		if len(deadLetter) != 0 {
+			t.Error("expected the replayed request to succeed")
+		}
+	})
+
+	t.Run("test errors that are not retryable are dead-lettered at once", func(t *testing.T) {
+		deadLetter := make(RequestQueue, 1)
+		producer, dispatcher := run(processorFunc(func(*Request) error { return failure }), deadLetter,
+			WithRetryable(func(err error) bool { return !errors.Is(err, failure) }))
+		if err := publish(t, producer); !errors.Is(err, ErrNotRetryable) {
+			t.Errorf("expected ErrNotRetryable, got %v", err)
+		}
+		if req := <-deadLetter; len(req.Attempts()) != 1 {
+			t.Errorf("expected a single attempt, got %d", len(req.Attempts()))
+		}
+		if stats := dispatcher.Stats(); stats.Retries != 0 {
+			t.Errorf("expected no retries, got %+v", stats)
+		}
+	})
+	t.Run("test cancelled and expired requests are not dead-lettered", func(t *testing.T) {
+		deadLetter := make(RequestQueue, 1)
+		var release atomic.Bool
+		producer, dispatcher := run(ContextProcessorFunc(func(ctx context.Context, req *Request) error {
+			if release.Load() {
+				return ErrExpired
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}), deadLetter)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		if err := publishWith(t, producer, ctx, "batch-1"); !errors.Is(err, context.Canceled) || errors.Is(err, ErrNotRetryable) {
+			t.Errorf("expected the cancellation to be reported as it is, got %v", err)
+		}
+
+		release.Store(true)
+		if err := publishWith(t, producer, context.Background(), "batch-2"); !errors.Is(err, ErrExpired) {
+			t.Errorf("expected ErrExpired, got %v", err)
+		}
+		if stats := dispatcher.Stats(); stats.DeadLettered != 0 || stats.Retries != 0 || stats.Expired != 1 {
+			t.Errorf("expected no retries or dead letters and 1 expired request, got %+v", stats)
+		}
+		if len(deadLetter) != 0 {
+			t.Errorf("expected the dead letter queue to be empty, got %d", len(deadLetter))
+		}
+	})
+}
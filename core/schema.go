@@ -0,0 +1,427 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// name of a wire type that can be used in a schema
+type FieldKind string
+
+const (
+	KindUint8   FieldKind = "uint8"
+	KindUint16  FieldKind = "uint16"
+	KindUint32  FieldKind = "uint32"
+	KindUint64  FieldKind = "uint64"
+	KindInt8    FieldKind = "int8"
+	KindInt16   FieldKind = "int16"
+	KindInt32   FieldKind = "int32"
+	KindInt64   FieldKind = "int64"
+	KindFloat32 FieldKind = "float32"
+	KindFloat64 FieldKind = "float64"
+	KindBool    FieldKind = "bool"
+	KindString  FieldKind = "string" // uint32 length prefix followed by utf-8 bytes
+	KindBytes   FieldKind = "bytes"  // uint32 length prefix followed by raw bytes
+	KindList    FieldKind = "list"   // uint32 element count followed by each element encoded with Elem
+	KindTagged  FieldKind = "tagged" // tag-length-value entries up to the end of the message, must be last
+)
+
+// declarative description of a single field in a message layout
+type FieldSpec struct {
+	Name string    // name of the field, matched against ByteField.Name
+	Kind FieldKind // wire type of the field
+	Elem Schema    // layout of every element when Kind is KindList
+	Len  int       // fixed length of KindString and KindBytes fields, 0 for a uint32 length prefix
+}
+
+// ordered list of fields describing a message layout on the wire
+type Schema []FieldSpec
+
+// Defines how a single kind of field is written to and read from the wire.
+type FieldType interface {
+	Type() reflect.Type                                              // go type a decoded ByteField.Value points to
+	Encode(e *FieldEncoder, spec FieldSpec, value interface{}) error // value may be a pointer or a plain value
+	Decode(d *FieldDecoder, spec FieldSpec) (interface{}, error)     // returns a pointer to the decoded value
+}
+
+var (
+	fieldTypesLock sync.RWMutex
+	fieldTypes     = make(map[FieldKind]FieldType)    // registry of field types by kind
+	fieldKinds     = make(map[reflect.Type]FieldKind) // reverse lookup used to infer schemas from ByteFields
+)
+
+func init() {
+	RegisterFieldType(KindUint8, fixedFieldType{reflect.TypeOf(uint8(0))})
+	RegisterFieldType(KindUint16, fixedFieldType{reflect.TypeOf(uint16(0))})
+	RegisterFieldType(KindUint32, fixedFieldType{reflect.TypeOf(uint32(0))})
+	RegisterFieldType(KindUint64, fixedFieldType{reflect.TypeOf(uint64(0))})
+	RegisterFieldType(KindInt8, fixedFieldType{reflect.TypeOf(int8(0))})
+	RegisterFieldType(KindInt16, fixedFieldType{reflect.TypeOf(int16(0))})
+	RegisterFieldType(KindInt32, fixedFieldType{reflect.TypeOf(int32(0))})
+	RegisterFieldType(KindInt64, fixedFieldType{reflect.TypeOf(int64(0))})
+	RegisterFieldType(KindFloat32, fixedFieldType{reflect.TypeOf(float32(0))})
+	RegisterFieldType(KindFloat64, fixedFieldType{reflect.TypeOf(float64(0))})
+	RegisterFieldType(KindBool, fixedFieldType{reflect.TypeOf(false)})
+	RegisterFieldType(KindString, stringFieldType{})
+	RegisterFieldType(KindBytes, bytesFieldType{})
+	RegisterFieldType(KindList, listFieldType{})
+	RegisterFieldType(KindTagged, taggedFieldType{})
+}
+
+// registers a field type so schemas can refer to it by kind, replaces any existing registration
+func RegisterFieldType(kind FieldKind, ft FieldType) {
+	fieldTypesLock.Lock()
+	defer fieldTypesLock.Unlock()
+	fieldTypes[kind] = ft
+	fieldKinds[ft.Type()] = kind
+}
+
+// get the registered field type for a kind
+func LookupFieldType(kind FieldKind) (FieldType, error) {
+	fieldTypesLock.RLock()
+	defer fieldTypesLock.RUnlock()
+	ft, ok := fieldTypes[kind]
+	if !ok {
+		return nil, fmt.Errorf("%w: no field type registered for kind %q", ErrUnknownField, kind)
+	}
+	return ft, nil
+}
+
+// infer a schema from the data types of the given fields, used when a codec has no schema attached
+func SchemaFromFields(fields ByteFields) (Schema, error) {
+	schema := make(Schema, 0, len(fields))
+	for _, field := range fields {
+		fieldTypesLock.RLock()
+		kind, ok := fieldKinds[field.DataType]
+		fieldTypesLock.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("no field type registered for %v (field %s)", field.DataType, field.Name)
+		}
+		spec := FieldSpec{Name: field.Name, Kind: kind}
+		if list, ok := FieldValue[[]ByteFields](field); ok && kind == KindList && len(list) > 0 {
+			elem, err := SchemaFromFields(list[0])
+			if err != nil {
+				return nil, err
+			}
+			spec.Elem = elem
+		}
+		schema = append(schema, spec)
+	}
+	return schema, nil
+}
+
+// get field by name
+func (fields ByteFields) Get(name string) (ByteField, bool) {
+	for _, field := range fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return ByteField{}, false
+}
+
+// encode fields in the order given by the schema
+func encodeFields(e *FieldEncoder, schema Schema, fields ByteFields) error {
+	for _, spec := range schema {
+		field, ok := fields.Get(spec.Name)
+		if !ok {
+			return fmt.Errorf("missing value for field %s", spec.Name)
+		}
+		ft, err := LookupFieldType(spec.Kind)
+		if err != nil {
+			return err
+		}
+		if err := ft.Encode(e, spec, field.Value); err != nil {
+			return fmt.Errorf("field %s: %w", spec.Name, err)
+		}
+	}
+	return nil
+}
+
+// decode fields in the order given by the schema
+func decodeFields(d *FieldDecoder, schema Schema) (ByteFields, error) {
+	fields := make(ByteFields, 0, len(schema))
+	for _, spec := range schema {
+		ft, err := LookupFieldType(spec.Kind)
+		if err != nil {
+			return nil, err
+		}
+		value, err := ft.Decode(d, spec)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", spec.Name, err)
+		}
+		fields = append(fields, ByteField{spec.Name, ft.Type(), value})
+	}
+	return fields, nil
+}
+
+// writes little-endian values to the underlying buffer for field types
+type FieldEncoder struct {
+	buf *bytes.Buffer
+}
+
+func NewFieldEncoder(buf *bytes.Buffer) *FieldEncoder {
+	return &FieldEncoder{buf}
+}
+
+// write a fixed size value
+func (e *FieldEncoder) Write(value interface{}) error {
+	return binary.Write(e.buf, binary.LittleEndian, value)
+}
+
+// write a uint32 length prefix
+func (e *FieldEncoder) WriteLength(n int) error {
+	if n < 0 || uint64(n) > math.MaxUint32 {
+		return fmt.Errorf("length %d does not fit in a uint32 prefix", n)
+	}
+	return e.Write(uint32(n))
+}
+
+// write raw bytes without a prefix
+func (e *FieldEncoder) WriteBytes(b []byte) error {
+	_, err := e.buf.Write(b)
+	return err
+}
+
+// write b with a length prefix, or zero padded to spec.Len when the field has a fixed length
+func (e *FieldEncoder) writeVariable(spec FieldSpec, b []byte) error {
+	if spec.Len == 0 {
+		if err := e.WriteLength(len(b)); err != nil {
+			return err
+		}
+		return e.WriteBytes(b)
+	}
+	if len(b) > spec.Len {
+		return fmt.Errorf("%w: %d bytes do not fit in a fixed length of %d", ErrLengthTooLarge, len(b), spec.Len)
+	}
+	if err := e.WriteBytes(b); err != nil {
+		return err
+	}
+	return e.WriteBytes(make([]byte, spec.Len-len(b)))
+}
+
+// reads little-endian values from the underlying reader for field types
+type FieldDecoder struct {
+	r            *bytes.Reader
+	maxFieldSize int // largest length ReadBytes accepts
+}
+
+func NewFieldDecoder(r *bytes.Reader) *FieldDecoder {
+	return &FieldDecoder{r, DefaultDecodeLimits.MaxFieldSize}
+}
+
+// creates a FieldDecoder for body that enforces the field limit
+func newLimitedFieldDecoder(body []byte, limits DecodeLimits) *FieldDecoder {
+	return &FieldDecoder{bytes.NewReader(body), limits.orDefault().MaxFieldSize}
+}
+
+// read a fixed size value into a pointer
+func (d *FieldDecoder) Read(value interface{}) error {
+	if err := binary.Read(d.r, binary.LittleEndian, value); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("%w: reading %T", ErrTruncated, value)
+		}
+		return err
+	}
+	return nil
+}
+
+// read a uint32 length prefix
+func (d *FieldDecoder) ReadLength() (uint32, error) {
+	var length uint32
+	err := d.Read(&length)
+	return length, err
+}
+
+// read n raw bytes, n is checked against the field limit and the unread bytes before allocating
+func (d *FieldDecoder) ReadBytes(n uint32) ([]byte, error) {
+	if uint64(n) > uint64(d.maxFieldSize) {
+		return nil, fmt.Errorf("%w: %d bytes, limit is %d", ErrLengthTooLarge, n, d.maxFieldSize)
+	}
+	if uint64(n) > uint64(d.Remaining()) {
+		return nil, fmt.Errorf("%w: length %d exceeds the %d bytes left", ErrTruncated, n, d.Remaining())
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// read bytes written by writeVariable
+func (d *FieldDecoder) readVariable(spec FieldSpec) ([]byte, error) {
+	if spec.Len > 0 {
+		return d.ReadBytes(uint32(spec.Len))
+	}
+	length, err := d.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+	return d.ReadBytes(length)
+}
+
+// number of unread bytes
+func (d *FieldDecoder) Remaining() int {
+	return d.r.Len()
+}
+
+// get the value of a field whether it holds T or *T, for use in FromFields methods
+func FieldValue[T any](field ByteField) (T, bool) {
+	switch v := field.Value.(type) {
+	case T:
+		return v, true
+	case *T:
+		if v != nil {
+			return *v, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// fixed size numbers and bools, written with encoding/binary
+type fixedFieldType struct {
+	typ reflect.Type
+}
+
+func (t fixedFieldType) Type() reflect.Type {
+	return t.typ
+}
+
+func (t fixedFieldType) Encode(e *FieldEncoder, spec FieldSpec, value interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	if !v.IsValid() || v.Kind() != t.typ.Kind() {
+		return fmt.Errorf("%w: expected %v, got %T", ErrTypeMismatch, t.typ, value)
+	}
+	return e.Write(v.Convert(t.typ).Interface())
+}
+
+func (t fixedFieldType) Decode(d *FieldDecoder, spec FieldSpec) (interface{}, error) {
+	ptr := reflect.New(t.typ)
+	if err := d.Read(ptr.Interface()); err != nil {
+		return nil, err
+	}
+	return ptr.Interface(), nil
+}
+
+type bytesFieldType struct{}
+
+func (bytesFieldType) Type() reflect.Type {
+	return reflect.TypeOf([]byte(nil))
+}
+
+func (bytesFieldType) Encode(e *FieldEncoder, spec FieldSpec, value interface{}) error {
+	b, ok := FieldValue[[]byte](ByteField{Value: value})
+	if !ok {
+		return fmt.Errorf("%w: expected []byte, got %T", ErrTypeMismatch, value)
+	}
+	return e.writeVariable(spec, b)
+}
+
+func (bytesFieldType) Decode(d *FieldDecoder, spec FieldSpec) (interface{}, error) {
+	b, err := d.readVariable(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+type stringFieldType struct{}
+
+func (stringFieldType) Type() reflect.Type {
+	return reflect.TypeOf("")
+}
+
+func (stringFieldType) Encode(e *FieldEncoder, spec FieldSpec, value interface{}) error {
+	s, ok := FieldValue[string](ByteField{Value: value})
+	if !ok {
+		return fmt.Errorf("%w: expected string, got %T", ErrTypeMismatch, value)
+	}
+	return e.writeVariable(spec, []byte(s))
+}
+
+func (stringFieldType) Decode(d *FieldDecoder, spec FieldSpec) (interface{}, error) {
+	b, err := d.readVariable(spec)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Len > 0 {
+		b = bytes.TrimRight(b, "\x00")
+	}
+	s := string(b)
+	return &s, nil
+}
+
+// fewest bytes a record of the schema is encoded in, kinds of unknown size count as 0
+func minEncodedSize(schema Schema) int {
+	size := 0
+	for _, spec := range schema {
+		ft, err := LookupFieldType(spec.Kind)
+		if err != nil {
+			continue
+		}
+		switch ft := ft.(type) {
+		case fixedFieldType:
+			size += int(ft.typ.Size())
+		case stringFieldType, bytesFieldType:
+			if spec.Len > 0 {
+				size += spec.Len
+			} else {
+				size += 4
+			}
+		case listFieldType:
+			size += 4
+		}
+	}
+	return size
+}
+
+// list of nested records, every element is encoded with the Elem schema of the spec
+type listFieldType struct{}
+
+func (listFieldType) Type() reflect.Type {
+	return reflect.TypeOf([]ByteFields(nil))
+}
+
+func (listFieldType) Encode(e *FieldEncoder, spec FieldSpec, value interface{}) error {
+	list, ok := FieldValue[[]ByteFields](ByteField{Value: value})
+	if !ok {
+		return fmt.Errorf("%w: expected []ByteFields, got %T", ErrTypeMismatch, value)
+	}
+	if err := e.WriteLength(len(list)); err != nil {
+		return err
+	}
+	for i, elem := range list {
+		if err := encodeFields(e, spec.Elem, elem); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (listFieldType) Decode(d *FieldDecoder, spec FieldSpec) (interface{}, error) {
+	count, err := d.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+	// a count the unread bytes cannot hold is rejected before allocating, elements that may be
+	// empty leave it unbounded
+	if size := minEncodedSize(spec.Elem); size > 0 && uint64(count)*uint64(size) > uint64(d.Remaining()) {
+		return nil, fmt.Errorf("%w: %d elements do not fit in %d bytes", ErrTruncated, count, d.Remaining())
+	}
+	list := make([]ByteFields, 0, min(uint64(count), uint64(d.Remaining())))
+	for i := uint32(0); i < count; i++ {
+		elem, err := decodeFields(d, spec.Elem)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		list = append(list, elem)
+	}
+	return &list, nil
+}
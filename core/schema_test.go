@@ -0,0 +1,159 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaCodec(t *testing.T) {
+	readingSchema := Schema{
+		{Name: "Station", Kind: KindString},
+		{Name: "Temperature", Kind: KindFloat64},
+	}
+	schema := Schema{
+		{Name: "Id", Kind: KindUint64},
+		{Name: "Offset", Kind: KindInt32},
+		{Name: "Name", Kind: KindString},
+		{Name: "Raw", Kind: KindBytes},
+		{Name: "Readings", Kind: KindList, Elem: readingSchema},
+	}
+
+	id := uint64(7)
+	offset := int32(-3)
+	name := "batch"
+	raw := []byte{0xde, 0xad}
+	readings := []ByteFields{
+		{
+			{"Station", reflect.TypeOf(""), "Helsinki"},
+			{"Temperature", reflect.TypeOf(float64(0)), 15.5},
+		},
+		{
+			{"Station", reflect.TypeOf(""), "Lisbon"},
+			{"Temperature", reflect.TypeOf(float64(0)), 22.25},
+		},
+	}
+	fields := ByteFields{
+		{"Id", reflect.TypeOf(id), &id},
+		{"Offset", reflect.TypeOf(offset), &offset},
+		{"Name", reflect.TypeOf(name), &name},
+		{"Raw", reflect.TypeOf(raw), &raw},
+		{"Readings", reflect.TypeOf(readings), &readings},
+	}
+
+	t.Run("test round trip with declared schema", func(t *testing.T) {
+		encoded := NewSerialisable()
+		encoded.Codec.AddSchema(schema)
+		encoded.Codec.AddFields(fields)
+		if err := encoded.Encode(); err != nil {
+			t.Fatalf("encoding failed: %v", err)
+		}
+
+		decoder := NewSerialisable()
+		decoder.Codec = NewMessageCodec(schema)
+		decoder.InsertDataToSerialisableBuffer(encoded.buf.Bytes())
+		decoded, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("decoding failed: %v", err)
+		}
+
+		if got, _ := FieldValue[uint64](decoded[0]); got != id {
+			t.Errorf("Id mismatch: got %d, want %d", got, id)
+		}
+		if got, _ := FieldValue[int32](decoded[1]); got != offset {
+			t.Errorf("Offset mismatch: got %d, want %d", got, offset)
+		}
+		if got, _ := FieldValue[string](decoded[2]); got != name {
+			t.Errorf("Name mismatch: got %s, want %s", got, name)
+		}
+		if got, _ := FieldValue[[]byte](decoded[3]); !bytes.Equal(got, raw) {
+			t.Errorf("Raw mismatch: got %x, want %x", got, raw)
+		}
+		gotReadings, _ := FieldValue[[]ByteFields](decoded[4])
+		if len(gotReadings) != len(readings) {
+			t.Fatalf("Readings length mismatch: got %d, want %d", len(gotReadings), len(readings))
+		}
+		for i, reading := range gotReadings {
+			station, _ := FieldValue[string](reading[0])
+			temperature, _ := FieldValue[float64](reading[1])
+			if station != readings[i][0].Value || temperature != readings[i][1].Value {
+				t.Errorf("reading %d mismatch: got %s %v", i, station, temperature)
+			}
+		}
+	})
+
+	t.Run("test schema is inferred from fields", func(t *testing.T) {
+		inferred, err := SchemaFromFields(fields)
+		if err != nil {
+			t.Fatalf("inference failed: %v", err)
+		}
+		if !reflect.DeepEqual(inferred, schema) {
+			t.Errorf("schema mismatch: got %v, want %v", inferred, schema)
+		}
+	})
+
+	t.Run("test missing field fails to encode", func(t *testing.T) {
+		s := NewSerialisable()
+		s.Codec.AddSchema(schema)
+		s.Codec.AddFields(fields[:2])
+		if err := s.Encode(); err == nil {
+			t.Errorf("expected error for missing field")
+		}
+	})
+
+	t.Run("test unknown kind fails to encode", func(t *testing.T) {
+		s := NewSerialisable()
+		s.Codec.AddSchema(Schema{{Name: "Id", Kind: "complex128"}})
+		s.Codec.AddFields(fields)
+		if err := s.Encode(); err == nil {
+			t.Errorf("expected error for unregistered kind")
+		}
+	})
+
+	t.Run("test list counts are bounded by the element size", func(t *testing.T) {
+		decodeList := func(elem Schema, body []byte) ([]ByteFields, error) {
+			value, err := listFieldType{}.Decode(NewFieldDecoder(bytes.NewReader(body)), FieldSpec{Kind: KindList, Elem: elem})
+			if err != nil {
+				return nil, err
+			}
+			return *value.(*[]ByteFields), nil
+		}
+
+		// 3 elements of 8 bytes cannot fit in the 16 bytes after the count
+		body := binary.LittleEndian.AppendUint32(nil, 3)
+		body = append(body, make([]byte, 16)...)
+		if _, err := decodeList(Schema{{Name: "Id", Kind: KindUint64}}, body); !errors.Is(err, ErrTruncated) {
+			t.Errorf("expected ErrTruncated, got %v", err)
+		}
+
+		// elements that may be empty are not bounded
+		list, err := decodeList(Schema{{Name: "Extra", Kind: KindTagged}}, binary.LittleEndian.AppendUint32(nil, 3))
+		if err != nil || len(list) != 3 {
+			t.Errorf("expected 3 empty elements, got %v, %v", list, err)
+		}
+	})
+}
+
+type celsius float32
+
+func TestRegisterFieldType(t *testing.T) {
+	RegisterFieldType("celsius", fixedFieldType{reflect.TypeOf(celsius(0))})
+
+	temperature := celsius(21.5)
+	s := NewSerialisable()
+	s.Codec.AddSchema(Schema{{Name: "Temperature", Kind: "celsius"}})
+	s.Codec.AddFields(ByteFields{{"Temperature", reflect.TypeOf(temperature), &temperature}})
+	if err := s.Encode(); err != nil {
+		t.Fatalf("encoding failed: %v", err)
+	}
+
+	decoded, err := s.Decode()
+	if err != nil {
+		t.Fatalf("decoding failed: %v", err)
+	}
+	if got, _ := FieldValue[celsius](decoded[0]); got != temperature {
+		t.Errorf("temperature mismatch: got %v, want %v", got, temperature)
+	}
+}
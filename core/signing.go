@@ -0,0 +1,151 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+// headers used to carry the signature of a payload
+const (
+	HeaderKeyId     = "gewh-key-id"    // id of the key in the KeyRing used to sign
+	HeaderSignature = "gewh-signature" // hex encoded HMAC-SHA256
+)
+
+// holds the HMAC keys shared between producers and brokers. Keys are rotated by adding
+// a new current key while keeping the old ones for verification until they are removed.
+type KeyRing struct {
+	sync.RWMutex
+	keys    map[string][]byte // secrets by key id
+	current string            // key id used for signing
+}
+
+func NewKeyRing() *KeyRing {
+	return &KeyRing{
+		keys: make(map[string][]byte),
+	}
+}
+
+// add a key that can be used to verify signatures
+func (k *KeyRing) Add(id string, secret []byte) {
+	k.Lock()
+	defer k.Unlock()
+	k.keys[id] = append([]byte{}, secret...)
+}
+
+// add a key and sign with it from now on, older keys still verify
+func (k *KeyRing) Rotate(id string, secret []byte) {
+	k.Lock()
+	defer k.Unlock()
+	k.keys[id] = append([]byte{}, secret...)
+	k.current = id
+}
+
+// remove a key, signatures made with it no longer verify
+func (k *KeyRing) Remove(id string) {
+	k.Lock()
+	defer k.Unlock()
+	delete(k.keys, id)
+	if k.current == id {
+		k.current = ""
+	}
+}
+
+// get the key used for signing
+func (k *KeyRing) Current() (string, []byte, error) {
+	k.RLock()
+	defer k.RUnlock()
+	if k.current == "" {
+		return "", nil, ErrNoSigningKey
+	}
+	return k.current, k.keys[k.current], nil
+}
+
+// get a key by id
+func (k *KeyRing) Key(id string) ([]byte, bool) {
+	k.RLock()
+	defer k.RUnlock()
+	secret, ok := k.keys[id]
+	return secret, ok
+}
+
+// sign the client id, identifier, data and headers of the payload with the current key of the
+// ring, the key id and signature are stored in the headers so the payload must be version 2 or later
+func SignPayload(payload *Payload, ring *KeyRing) error {
+	if payload.Version < 2 {
+		return fmt.Errorf("%w: version %d", ErrHeadersUnsupported, payload.Version)
+	}
+	id, secret, err := ring.Current()
+	if err != nil {
+		return err
+	}
+	payload.DelHeader(HeaderSignature)
+	payload.SetHeader(HeaderKeyId, id)
+	payload.AddHeader(HeaderSignature, hex.EncodeToString(payloadMAC(payload, secret)))
+	return nil
+}
+
+// check the signature of the payload against the key it names in the ring
+func VerifyPayload(payload *Payload, ring *KeyRing) error {
+	id, ok := payload.Headers.Get(HeaderKeyId)
+	if !ok {
+		return ErrUnsigned
+	}
+	signature, ok := payload.Headers.Get(HeaderSignature)
+	if !ok {
+		return ErrUnsigned
+	}
+	secret, ok := ring.Key(id)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, payloadMAC(payload, secret)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// dispatcher stage that rejects requests whose payload is not signed by a key in the ring
+func VerifySignatures(ring *KeyRing) Stage {
+	return StageFunc(func(req *Request) error {
+		payload, err := req.Message.DecodePayload()
+		if err != nil {
+			return err
+		}
+		return VerifyPayload(payload, ring)
+	})
+}
+
+// HMAC-SHA256 over the length prefixed client id, identifier, data, every header but the
+// signature and every tagged field
+func payloadMAC(payload *Payload, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	var scratch [4]byte
+	writePrefixed := func(b []byte) {
+		binary.LittleEndian.PutUint32(scratch[:], uint32(len(b)))
+		mac.Write(scratch[:])
+		mac.Write(b)
+	}
+
+	binary.LittleEndian.PutUint16(scratch[:2], payload.ClientId)
+	mac.Write(scratch[:2])
+	writePrefixed(payload.Identifier)
+	writePrefixed(payload.Data)
+	for _, header := range payload.Headers {
+		if header.Key == HeaderSignature {
+			continue
+		}
+		writePrefixed([]byte(header.Key))
+		writePrefixed([]byte(header.Value))
+	}
+	for _, field := range payload.Tagged {
+		binary.LittleEndian.PutUint16(scratch[:2], field.Tag)
+		mac.Write(scratch[:2])
+		writePrefixed(field.Value)
+	}
+	return mac.Sum(nil)
+}
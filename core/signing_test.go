@@ -0,0 +1,153 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSigning(t *testing.T) {
+	newPayload := func() *Payload {
+		return newTestPayload("Hello, World!", "content-type", "text/plain")
+	}
+
+	t.Run("test signed payload verifies", func(t *testing.T) {
+		ring := NewKeyRing()
+		ring.Rotate("k1", []byte("secret-1"))
+		payload := newPayload()
+		if err := SignPayload(payload, ring); err != nil {
+			t.Fatalf("signing failed: %v", err)
+		}
+		if id, _ := payload.Headers.Get(HeaderKeyId); id != "k1" {
+			t.Errorf("expected key id header k1, got %q", id)
+		}
+		if err := VerifyPayload(payload, ring); err != nil {
+			t.Errorf("verification failed: %v", err)
+		}
+	})
+
+	t.Run("test tampering is detected", func(t *testing.T) {
+		ring := NewKeyRing()
+		ring.Rotate("k1", []byte("secret-1"))
+		tamper := []func(*Payload){
+			func(p *Payload) { p.Data = []byte("Goodbye, World!") },
+			func(p *Payload) { p.Identifier = []byte("intruder") },
+			func(p *Payload) { p.ClientId = 7 },
+			func(p *Payload) { p.SetHeader("content-type", "text/csv") },
+			func(p *Payload) { p.AddHeader("route", "elsewhere") },
+			func(p *Payload) { SetTaggedValue(p, TagApplication, uint32(7)) },
+		}
+		for i, fn := range tamper {
+			payload := newPayload()
+			SignPayload(payload, ring)
+			fn(payload)
+			if err := VerifyPayload(payload, ring); !errors.Is(err, ErrBadSignature) {
+				t.Errorf("tamper %d: expected ErrBadSignature, got %v", i, err)
+			}
+		}
+	})
+
+	t.Run("test key rotation", func(t *testing.T) {
+		ring := NewKeyRing()
+		ring.Rotate("k1", []byte("secret-1"))
+		old := newPayload()
+		SignPayload(old, ring)
+
+		ring.Rotate("k2", []byte("secret-2"))
+		current := newPayload()
+		SignPayload(current, ring)
+		if id, _ := current.Headers.Get(HeaderKeyId); id != "k2" {
+			t.Errorf("expected new payloads to be signed with k2, got %q", id)
+		}
+		if err := VerifyPayload(old, ring); err != nil {
+			t.Errorf("expected old signature to verify during rotation: %v", err)
+		}
+
+		ring.Remove("k1")
+		if err := VerifyPayload(old, ring); !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("expected ErrUnknownKey after removal, got %v", err)
+		}
+		if err := VerifyPayload(current, ring); err != nil {
+			t.Errorf("verification failed: %v", err)
+		}
+	})
+
+	t.Run("test unsigned and unsignable payloads", func(t *testing.T) {
+		ring := NewKeyRing()
+		if err := SignPayload(newPayload(), ring); !errors.Is(err, ErrNoSigningKey) {
+			t.Errorf("expected ErrNoSigningKey, got %v", err)
+		}
+		ring.Rotate("k1", []byte("secret-1"))
+		if err := VerifyPayload(newPayload(), ring); !errors.Is(err, ErrUnsigned) {
+			t.Errorf("expected ErrUnsigned, got %v", err)
+		}
+		if err := SignPayload(NewPayload(1, 42, nil, nil), ring); !errors.Is(err, ErrHeadersUnsupported) {
+			t.Errorf("expected ErrHeadersUnsupported, got %v", err)
+		}
+	})
+}
+
+func TestDispatcherVerifiesSignatures(t *testing.T) {
+	ring := NewKeyRing()
+	ring.Rotate("k1", []byte("secret-1"))
+	signer := NewProducer(WithSigning(ring))
+
+	forged := NewKeyRing()
+	forged.Rotate("k1", []byte("guessed"))
+	forger := NewProducer(WithSigning(forged))
+
+	ctx := context.Background()
+	valid, err := signer.NewRequest(1, NewPayload(CurrentPayloadVersion, 1, []byte("origin"), []byte("valid")), ctx)
+	if err != nil {
+		t.Fatalf("creating request failed: %v", err)
+	}
+	invalid, _ := forger.NewRequest(2, NewPayload(CurrentPayloadVersion, 2, []byte("origin"), []byte("forged")), ctx)
+	unsigned, _ := NewProducer().NewRequest(3, NewPayload(CurrentPayloadVersion, 3, []byte("origin"), []byte("unsigned")), ctx)
+
+	var processed atomic.Int32
+	cb := MockDataProcessingFn(func(field []byte) []byte { return field })
+	recorder := processorFunc(func(req *Request) error {
+		processed.Add(1)
+		return cb.Process(req)
+	})
+
+	quarantine := make(RequestQueue, 3)
+	dispatcher := NewDispatcher(1, 1)
+	dispatcher.AddQueue(make(RequestQueue, 3))
+	dispatcher.AddStage(VerifySignatures(ring))
+	dispatcher.AddQuarantine(quarantine)
+	dispatcher.Run(recorder)
+	broker := NewProducer()
+	broker.Subscribe(dispatcher)
+
+	if _, err := waitFuture(t, broker.Publish(ctx, valid)); err != nil {
+		t.Errorf("expected the valid request to be processed, got %v", err)
+	}
+	if _, err := waitFuture(t, broker.Publish(ctx, invalid)); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("expected the forged request to be rejected, got %v", err)
+	}
+	if _, err := waitFuture(t, broker.Publish(ctx, unsigned)); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("expected the unsigned request to be rejected, got %v", err)
+	}
+	if got := processed.Load(); got != 1 {
+		t.Errorf("expected only the valid request to be processed, got %d", got)
+	}
+
+	quarantined := make(map[int]bool)
+	for len(quarantined) < 2 {
+		select {
+		case req := <-quarantine:
+			quarantined[req.Id] = true
+		case <-time.After(time.Second):
+			t.Fatalf("expected two quarantined requests, got %v", quarantined)
+		}
+	}
+	if !quarantined[2] || !quarantined[3] {
+		t.Errorf("expected forged and unsigned requests to be quarantined, got %v", quarantined)
+	}
+	if got := dispatcher.Stats().Rejected; got != 2 {
+		t.Errorf("expected 2 rejected requests, got %d", got)
+	}
+}
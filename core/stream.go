@@ -0,0 +1,113 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// reads back-to-back frames from a stream such as a connection, pipe or file
+type FrameReader struct {
+	r      io.Reader
+	opts   []SerialisableOpt     // options for the serialisables returned by ReadSerialisable
+	limits DecodeLimits          // taken from opts, bounds the frames read
+	header [FrameHeaderSize]byte // scratch space for the header of the next frame
+}
+
+// creates a FrameReader, opts are applied to every serialisable it returns
+func NewFrameReader(r io.Reader, opts ...SerialisableOpt) *FrameReader {
+	opts = append(append([]SerialisableOpt{}, opts...), WithFraming())
+	return &FrameReader{
+		r:      r,
+		opts:   opts,
+		limits: NewSerialisable(opts...).limits.orDefault(),
+	}
+}
+
+// read the next complete frame, returns io.EOF when the stream ends between frames
+// and ErrTruncated when it ends inside one. A frame that fails validation leaves the
+// stream at an unknown position so the reader should not be used afterwards.
+func (fr *FrameReader) ReadFrame() ([]byte, error) {
+	if _, err := io.ReadFull(fr.r, fr.header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: stream ended inside a frame header", ErrTruncated)
+		}
+		return nil, err
+	}
+	header, err := ParseFrameHeader(fr.header[:])
+	if err != nil {
+		return nil, err
+	}
+	if err := fr.limits.checkMessage(int(header.Length)); err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, header.Length)
+	copy(frame, fr.header[:])
+	if _, err := io.ReadFull(fr.r, frame[FrameHeaderSize:]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: stream ended inside a frame of %d bytes", ErrTruncated, header.Length)
+		}
+		return nil, err
+	}
+	if _, _, err := ParseFrame(frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// read the next frame into a framed serialisable
+func (fr *FrameReader) ReadSerialisable() (*Serialisable, error) {
+	frame, err := fr.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+	s := NewSerialisable(fr.opts...)
+	s.InsertDataToSerialisableBuffer(frame)
+	return s, nil
+}
+
+// read the next frame and decode it into a payload
+func (fr *FrameReader) ReadPayload() (*Payload, error) {
+	s, err := fr.ReadSerialisable()
+	if err != nil {
+		return nil, err
+	}
+	return s.DecodePayload()
+}
+
+// writes back-to-back frames to a stream
+type FrameWriter struct {
+	w    io.Writer
+	opts []SerialisableOpt // options for the serialisables created by WritePayload
+}
+
+// creates a FrameWriter, opts are applied when encoding payloads
+func NewFrameWriter(w io.Writer, opts ...SerialisableOpt) *FrameWriter {
+	return &FrameWriter{
+		w:    w,
+		opts: append(append([]SerialisableOpt{}, opts...), WithFraming()),
+	}
+}
+
+// write the message of the serialisable as a single frame, unframed messages are framed first
+func (fw *FrameWriter) WriteSerialisable(s *Serialisable) error {
+	if s.buf == nil {
+		return ErrEmptyBuffer
+	}
+	frame := s.buf.Bytes()
+	if !s.framed {
+		frame = AppendFrame(nil, 0, frame)
+	}
+	_, err := fw.w.Write(frame)
+	return err
+}
+
+// encode a payload and write it as a single frame
+func (fw *FrameWriter) WritePayload(payload *Payload) error {
+	s := NewSerialisable(fw.opts...)
+	if err := s.EncodePayload(payload); err != nil {
+		return err
+	}
+	return fw.WriteSerialisable(s)
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"testing/iotest"
+)
+
+func TestFrameStream(t *testing.T) {
+	payloads := []*Payload{
+		NewPayload(CurrentPayloadVersion, 1, []byte("origin"), []byte("1. Hello, Stream!")),
+		NewPayload(CurrentPayloadVersion, 2, []byte("origin"), []byte("2. Hello, Stream!")),
+		NewPayload(CurrentPayloadVersion, 3, []byte("origin"), []byte("")),
+	}
+
+	writeAll := func(w io.Writer) error {
+		fw := NewFrameWriter(w)
+		for _, payload := range payloads {
+			if err := fw.WritePayload(payload); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	t.Run("test reading back-to-back frames with partial reads", func(t *testing.T) {
+		var stream bytes.Buffer
+		if err := writeAll(&stream); err != nil {
+			t.Fatalf("writing failed: %v", err)
+		}
+
+		fr := NewFrameReader(iotest.OneByteReader(&stream))
+		for i, want := range payloads {
+			got, err := fr.ReadPayload()
+			if err != nil {
+				t.Fatalf("reading payload %d failed: %v", i, err)
+			}
+			if got.ClientId != want.ClientId || !bytes.Equal(got.Data, want.Data) {
+				t.Errorf("payload %d mismatch: got %v, want %v", i, got, want)
+			}
+		}
+		if _, err := fr.ReadFrame(); err != io.EOF {
+			t.Errorf("expected io.EOF after last frame, got %v", err)
+		}
+	})
+
+	t.Run("test reading over a pipe", func(t *testing.T) {
+		r, w := io.Pipe()
+		go func() {
+			w.CloseWithError(writeAll(w))
+		}()
+
+		fr := NewFrameReader(r)
+		count := 0
+		for {
+			s, err := fr.ReadSerialisable()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("reading failed: %v", err)
+			}
+			if !s.IsFramed() {
+				t.Errorf("expected framed serialisable")
+			}
+			count++
+		}
+		if count != len(payloads) {
+			t.Errorf("expected %d frames, got %d", len(payloads), count)
+		}
+	})
+
+	t.Run("test stream ending inside a frame", func(t *testing.T) {
+		var stream bytes.Buffer
+		if err := writeAll(&stream); err != nil {
+			t.Fatalf("writing failed: %v", err)
+		}
+		truncated := stream.Bytes()[:stream.Len()-3]
+
+		fr := NewFrameReader(bytes.NewReader(truncated))
+		var err error
+		for err == nil {
+			_, err = fr.ReadFrame()
+		}
+		if !errors.Is(err, ErrTruncated) {
+			t.Errorf("expected ErrTruncated, got %v", err)
+		}
+	})
+
+	t.Run("test unframed serialisable is framed on write", func(t *testing.T) {
+		req := createAndFormatTestRequest(payloads[0], 1, context.Background())
+		var stream bytes.Buffer
+		if err := NewFrameWriter(&stream).WriteSerialisable(req.Message); err != nil {
+			t.Fatalf("writing failed: %v", err)
+		}
+		got, err := NewFrameReader(&stream).ReadPayload()
+		if err != nil {
+			t.Fatalf("reading failed: %v", err)
+		}
+		if !reflect.DeepEqual(got, payloads[0]) {
+			t.Errorf("payload mismatch: got %v, want %v", got, payloads[0])
+		}
+	})
+}
+
+func ExampleFrameReader() {
+	var stream bytes.Buffer
+	fw := NewFrameWriter(&stream)
+	fw.WritePayload(NewPayload(1, 7, []byte("origin"), []byte("replayed")))
+
+	fr := NewFrameReader(&stream)
+	for {
+		payload, err := fr.ReadPayload()
+		if err != nil {
+			break
+		}
+		fmt.Printf("%d %s\n", payload.ClientId, payload.Data)
+	}
+	// Output: 7 replayed
+}
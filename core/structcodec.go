@@ -0,0 +1,253 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Encodes plain Go structs without hand-written ToFields/FromFields. Exported fields are
+// encoded in declaration order and can be tagged with
+//
+//	`gewh:"name,len=N"`
+//
+// where name replaces the field name on the wire, len=N gives a string or []byte field a
+// fixed length of N zero padded bytes instead of a length prefix and a name of "-" skips
+// the field. Fields can be fixed size numbers, bools, strings, byte slices, slices of
+// structs or any type registered with RegisterFieldType.
+type StructCodec[T any] struct {
+	layout *structLayout
+}
+
+// encoding of a struct type
+type structLayout struct {
+	schema Schema
+	fields []structField
+}
+
+type structField struct {
+	index int           // index of the field in the struct
+	spec  FieldSpec     // wire layout of the field
+	ft    FieldType     // field type registered for spec.Kind
+	elem  *structLayout // layout of the elements of a slice of structs
+}
+
+// go kinds that can be encoded when their type is not registered, for named types such as `type Celsius float32`
+var basicKinds = map[reflect.Kind]FieldKind{
+	reflect.Uint8:   KindUint8,
+	reflect.Uint16:  KindUint16,
+	reflect.Uint32:  KindUint32,
+	reflect.Uint64:  KindUint64,
+	reflect.Int8:    KindInt8,
+	reflect.Int16:   KindInt16,
+	reflect.Int32:   KindInt32,
+	reflect.Int64:   KindInt64,
+	reflect.Float32: KindFloat32,
+	reflect.Float64: KindFloat64,
+	reflect.Bool:    KindBool,
+	reflect.String:  KindString,
+}
+
+// creates a StructCodec for T, which must be a struct
+func NewStructCodec[T any]() (*StructCodec[T], error) {
+	layout, err := newStructLayout(reflect.TypeOf((*T)(nil)).Elem(), make(map[reflect.Type]bool))
+	if err != nil {
+		return nil, err
+	}
+	return &StructCodec[T]{layout}, nil
+}
+
+// wire layout of T
+func (c *StructCodec[T]) Schema() Schema {
+	return c.layout.schema
+}
+
+// transform a value into byte fields
+func (c *StructCodec[T]) ToFields(v *T) ByteFields {
+	return c.layout.toFields(reflect.ValueOf(v).Elem())
+}
+
+// transform byte fields into a value, every known field is applied and the first
+// unknown or mistyped one is reported
+func (c *StructCodec[T]) FromFields(fields ByteFields) (T, error) {
+	var v T
+	err := c.layout.fromFields(reflect.ValueOf(&v).Elem(), fields)
+	return v, err
+}
+
+// encode v into the serialisable with the layout of T
+func (c *StructCodec[T]) Encode(s *Serialisable, v T) error {
+	s.Codec.AddSchema(c.layout.schema)
+	s.Codec.AddFields(c.ToFields(&v))
+	return s.Encode()
+}
+
+// decode the serialisable into a value of T
+func (c *StructCodec[T]) Decode(s *Serialisable) (T, error) {
+	fields, err := s.decodeWith(c.layout.schema)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return c.FromFields(fields)
+}
+
+func newStructLayout(t reflect.Type, seen map[reflect.Type]bool) (*structLayout, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %v is not a struct", ErrTypeMismatch, t)
+	}
+	if seen[t] {
+		return nil, fmt.Errorf("%w: %v refers to itself", ErrTypeMismatch, t)
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	layout := &structLayout{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, length, err := parseStructTag(sf)
+		if err != nil {
+			return nil, err
+		}
+		if name == "-" {
+			continue
+		}
+		field := structField{index: i, spec: FieldSpec{Name: name, Len: length}}
+		if sf.Type.Kind() == reflect.Slice && sf.Type.Elem().Kind() == reflect.Struct {
+			if field.elem, err = newStructLayout(sf.Type.Elem(), seen); err != nil {
+				return nil, fmt.Errorf("field %s: %w", sf.Name, err)
+			}
+			field.spec.Kind = KindList
+			field.spec.Elem = field.elem.schema
+		} else if field.spec.Kind, err = kindOf(sf.Type); err != nil {
+			return nil, fmt.Errorf("field %s: %w", sf.Name, err)
+		}
+		if length > 0 && field.spec.Kind != KindString && field.spec.Kind != KindBytes {
+			return nil, fmt.Errorf("field %s: len only applies to strings and byte slices", sf.Name)
+		}
+		if field.ft, err = LookupFieldType(field.spec.Kind); err != nil {
+			return nil, err
+		}
+		layout.schema = append(layout.schema, field.spec)
+		layout.fields = append(layout.fields, field)
+	}
+	return layout, nil
+}
+
+// parse `gewh:"name,len=N"`, the name defaults to the field name
+func parseStructTag(sf reflect.StructField) (string, int, error) {
+	name, opts, _ := strings.Cut(sf.Tag.Get("gewh"), ",")
+	if name == "" {
+		name = sf.Name
+	}
+	length := 0
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == "" {
+			continue
+		}
+		value, ok := strings.CutPrefix(opt, "len=")
+		if !ok {
+			return "", 0, fmt.Errorf("field %s: unknown tag option %q", sf.Name, opt)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return "", 0, fmt.Errorf("field %s: invalid length %q", sf.Name, value)
+		}
+		length = n
+	}
+	return name, length, nil
+}
+
+// wire type of a go type, registered types take precedence over their underlying kind
+func kindOf(t reflect.Type) (FieldKind, error) {
+	fieldTypesLock.RLock()
+	kind, ok := fieldKinds[t]
+	fieldTypesLock.RUnlock()
+	if ok {
+		return kind, nil
+	}
+	if kind, ok := basicKinds[t.Kind()]; ok {
+		return kind, nil
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+		return KindBytes, nil
+	}
+	return "", fmt.Errorf("%w: no field type for %v", ErrTypeMismatch, t)
+}
+
+func (l *structLayout) toFields(v reflect.Value) ByteFields {
+	fields := make(ByteFields, 0, len(l.fields))
+	for _, f := range l.fields {
+		fv := v.Field(f.index)
+		var value interface{}
+		switch {
+		case f.elem != nil:
+			list := make([]ByteFields, fv.Len())
+			for i := range list {
+				list[i] = f.elem.toFields(fv.Index(i))
+			}
+			value = &list
+		case fv.Type() == f.ft.Type():
+			value = fv.Addr().Interface()
+		default:
+			// named types are encoded as the registered type of their kind
+			value = fv.Convert(f.ft.Type()).Interface()
+		}
+		fields = append(fields, ByteField{f.spec.Name, f.ft.Type(), value})
+	}
+	return fields
+}
+
+func (l *structLayout) fromFields(v reflect.Value, fields ByteFields) error {
+	var err error
+	for _, field := range fields {
+		f, ok := l.field(field.Name)
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("%w: %s", ErrUnknownField, field.Name)
+			}
+			continue
+		}
+		if setErr := f.set(v.Field(f.index), field); setErr != nil && err == nil {
+			err = setErr
+		}
+	}
+	return err
+}
+
+func (l *structLayout) field(name string) (structField, bool) {
+	for _, f := range l.fields {
+		if f.spec.Name == name {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+// set a struct field from a decoded byte field
+func (f structField) set(dst reflect.Value, field ByteField) error {
+	if f.elem != nil {
+		list, ok := FieldValue[[]ByteFields](field)
+		if !ok {
+			return fmt.Errorf("%w: %T for field %s", ErrTypeMismatch, field.Value, field.Name)
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(list), len(list))
+		for i, elem := range list {
+			if err := f.elem.fromFields(slice.Index(i), elem); err != nil {
+				return fmt.Errorf("field %s element %d: %w", field.Name, i, err)
+			}
+		}
+		dst.Set(slice)
+		return nil
+	}
+	src := reflect.Indirect(reflect.ValueOf(field.Value))
+	if !src.IsValid() || src.Kind() != dst.Kind() || !src.Type().ConvertibleTo(dst.Type()) {
+		return fmt.Errorf("%w: %T for field %s", ErrTypeMismatch, field.Value, field.Name)
+	}
+	dst.Set(src.Convert(dst.Type()))
+	return nil
+}
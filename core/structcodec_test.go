@@ -0,0 +1,153 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type stationReading struct {
+	Sensor      uint8
+	Temperature float64
+}
+
+type kelvin float32
+
+type stationReport struct {
+	Id       uint64 `gewh:"id"`
+	Station  string `gewh:"station,len=8"`
+	Offset   int32
+	Healthy  bool
+	Ambient  kelvin
+	Raw      []byte
+	Readings []stationReading
+	Comment  string `gewh:"-"`
+	internal int
+}
+
+// same layout as PayloadSchemaV1
+type structPayloadV1 struct {
+	Version    uint16
+	ClientId   uint16
+	Identifier []byte
+	Data       []byte
+}
+
+func TestStructCodec(t *testing.T) {
+	codec, err := NewStructCodec[stationReport]()
+	if err != nil {
+		t.Fatalf("creating codec failed: %v", err)
+	}
+	report := stationReport{
+		Id:       7,
+		Station:  "Athens",
+		Offset:   -3,
+		Healthy:  true,
+		Ambient:  293.5,
+		Raw:      []byte{0xDE, 0xAD},
+		Readings: []stationReading{{1, 21.5}, {2, 22.75}},
+	}
+
+	t.Run("test schema from tags", func(t *testing.T) {
+		want := Schema{
+			{Name: "id", Kind: KindUint64},
+			{Name: "station", Kind: KindString, Len: 8},
+			{Name: "Offset", Kind: KindInt32},
+			{Name: "Healthy", Kind: KindBool},
+			{Name: "Ambient", Kind: KindFloat32},
+			{Name: "Raw", Kind: KindBytes},
+			{Name: "Readings", Kind: KindList, Elem: Schema{
+				{Name: "Sensor", Kind: KindUint8},
+				{Name: "Temperature", Kind: KindFloat64},
+			}},
+		}
+		if !reflect.DeepEqual(codec.Schema(), want) {
+			t.Errorf("schema mismatch:\ngot  %v\nwant %v", codec.Schema(), want)
+		}
+	})
+
+	t.Run("test round trip", func(t *testing.T) {
+		s := NewSerialisable(WithFraming())
+		if err := codec.Encode(s, report); err != nil {
+			t.Fatalf("encoding failed: %v", err)
+		}
+		got, err := codec.Decode(s)
+		if err != nil {
+			t.Fatalf("decoding failed: %v", err)
+		}
+		want := report
+		want.Comment = ""
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("report mismatch:\ngot  %+v\nwant %+v", got, want)
+		}
+	})
+
+	t.Run("test fixed length fields", func(t *testing.T) {
+		long := report
+		long.Station = "Thessaloniki"
+		if err := codec.Encode(NewSerialisable(), long); !errors.Is(err, ErrLengthTooLarge) {
+			t.Errorf("expected ErrLengthTooLarge, got %v", err)
+		}
+
+		s := NewSerialisable()
+		codec.Encode(s, stationReport{})
+		// id, 8 station bytes, offset, healthy, ambient, raw prefix and readings count
+		if want := 8 + 8 + 4 + 1 + 4 + 4 + 4; s.buf.Len() != want {
+			t.Errorf("expected %d bytes, got %d", want, s.buf.Len())
+		}
+	})
+
+	t.Run("test compatible with the payload layout", func(t *testing.T) {
+		payloadCodec, err := NewStructCodec[structPayloadV1]()
+		if err != nil {
+			t.Fatalf("creating codec failed: %v", err)
+		}
+		if !reflect.DeepEqual(payloadCodec.Schema(), PayloadSchemaV1) {
+			t.Errorf("expected PayloadSchemaV1, got %v", payloadCodec.Schema())
+		}
+		s := NewSerialisable()
+		payloadCodec.Encode(s, structPayloadV1{1, 42, []byte("origin"), []byte("Hello, World!")})
+		payload, err := s.DecodePayload()
+		if err != nil {
+			t.Fatalf("decoding payload failed: %v", err)
+		}
+		if payload.ClientId != 42 || string(payload.Data) != "Hello, World!" {
+			t.Errorf("payload mismatch: %v", payload)
+		}
+	})
+
+	t.Run("test field errors", func(t *testing.T) {
+		version := uint16(1)
+		_, err := codec.FromFields(ByteFields{{"Missing", reflect.TypeOf(version), &version}})
+		if !errors.Is(err, ErrUnknownField) {
+			t.Errorf("expected ErrUnknownField, got %v", err)
+		}
+		_, err = codec.FromFields(ByteFields{{"Raw", reflect.TypeOf(version), &version}})
+		if !errors.Is(err, ErrTypeMismatch) {
+			t.Errorf("expected ErrTypeMismatch, got %v", err)
+		}
+	})
+}
+
+func TestStructCodecInvalidTypes(t *testing.T) {
+	if _, err := NewStructCodec[int](); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("expected ErrTypeMismatch for non struct, got %v", err)
+	}
+	if _, err := NewStructCodec[struct{ Values []int }](); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("expected ErrTypeMismatch for unsupported field, got %v", err)
+	}
+	if _, err := NewStructCodec[struct {
+		Id uint16 `gewh:"id,len=2"`
+	}](); err == nil {
+		t.Errorf("expected error for len on a number")
+	}
+	if _, err := NewStructCodec[struct {
+		Name string `gewh:"name,size=2"`
+	}](); err == nil {
+		t.Errorf("expected error for unknown tag option")
+	}
+	type node struct{ Children []node }
+	if _, err := NewStructCodec[node](); err == nil {
+		t.Errorf("expected error for recursive type")
+	}
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"unsafe"
+)
+
+// Tagged section of a payload (version 2 and later), written after the positional fields
+// and running to the end of the message (little-endian):
+//
+//	tag     uint16
+//	length  uint32
+//	value   [length]byte
+//
+// repeated in ascending tag order, each tag at most once. An empty section takes no bytes so
+// payloads without tagged fields keep their layout. Decoders keep tags they do not know so
+// they survive being re-encoded, and readers fall back to a default for missing tags, which
+// lets fields be added without a new payload version.
+
+// tags below TagApplication are assigned by gewh, the rest are free for applications
+const TagApplication uint16 = 0x8000
+
+// size of the tag and length in front of every tagged value
+const taggedEntryOverhead = 2 + 4
+
+// optional field in the tagged section of a payload
+type TaggedField struct {
+	Tag   uint16 `json:"tag"`
+	Value []byte `json:"value"`
+}
+
+// tagged fields in ascending tag order
+type TaggedFields []TaggedField
+
+// get the value of a tag
+func (t TaggedFields) Get(tag uint16) ([]byte, bool) {
+	i, ok := t.find(tag)
+	if !ok {
+		return nil, false
+	}
+	return t[i].Value, true
+}
+
+// index of the tag, or where it would be inserted
+func (t TaggedFields) find(tag uint16) (int, bool) {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Tag >= tag })
+	return i, i < len(t) && t[i].Tag == tag
+}
+
+// tags must be in strictly ascending order
+func (t TaggedFields) check() error {
+	for i := 1; i < len(t); i++ {
+		if t[i].Tag <= t[i-1].Tag {
+			return fmt.Errorf("%w: tag %d follows tag %d", ErrBadTagged, t[i].Tag, t[i-1].Tag)
+		}
+	}
+	return nil
+}
+
+// number of bytes the section takes
+func (t TaggedFields) binarySize() int {
+	size := 0
+	for _, field := range t {
+		size += taggedEntryOverhead + len(field.Value)
+	}
+	return size
+}
+
+func (t TaggedFields) appendBinary(dst []byte) ([]byte, error) {
+	if err := t.check(); err != nil {
+		return dst, err
+	}
+	for _, field := range t {
+		if uint64(len(field.Value)) > math.MaxUint32 {
+			return dst, fmt.Errorf("tag %d does not fit in a uint32 length prefix", field.Tag)
+		}
+		dst = binary.LittleEndian.AppendUint16(dst, field.Tag)
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(len(field.Value)))
+		dst = append(dst, field.Value...)
+	}
+	return dst, nil
+}
+
+// read the tagged section that makes up the rest of b, mode decides whether values alias b.
+// The fields are appended to the memory of old, whose values are reused with reuseBytes.
+func readTagged(b []byte, mode byteMode, old TaggedFields) (TaggedFields, error) {
+	tagged := old[:0]
+	for i := 0; len(b) > 0; i++ {
+		if len(b) < 2 {
+			return nil, fmt.Errorf("%w: missing tag", ErrTruncated)
+		}
+		tag := binary.LittleEndian.Uint16(b)
+		value, rest, err := readPrefixedBytes(b[2:])
+		if err != nil {
+			return nil, fmt.Errorf("tag %d: %w", tag, err)
+		}
+		var oldValue []byte
+		if i < len(old) {
+			oldValue = old[i].Value
+		}
+		tagged = append(tagged, TaggedField{tag, mode.take(oldValue, value)})
+		b = rest
+	}
+	if len(tagged) == 0 {
+		tagged = nil
+	}
+	if err := tagged.check(); err != nil {
+		return nil, err
+	}
+	return tagged, nil
+}
+
+// set the value of a tag, replacing any existing value
+func (p *Payload) SetTagged(tag uint16, value []byte) {
+	i, ok := p.Tagged.find(tag)
+	if ok {
+		p.Tagged[i].Value = value
+		return
+	}
+	p.Tagged = append(p.Tagged, TaggedField{})
+	copy(p.Tagged[i+1:], p.Tagged[i:])
+	p.Tagged[i] = TaggedField{tag, value}
+}
+
+// remove a tag
+func (p *Payload) DelTagged(tag uint16) {
+	if i, ok := p.Tagged.find(tag); ok {
+		p.Tagged = append(p.Tagged[:i], p.Tagged[i+1:]...)
+		if len(p.Tagged) == 0 {
+			p.Tagged = nil
+		}
+	}
+}
+
+// integers that can be stored in a tagged field
+type TaggedInteger interface {
+	~uint8 | ~uint16 | ~uint32 | ~uint64 | ~int8 | ~int16 | ~int32 | ~int64
+}
+
+// size of T in bytes
+func taggedSize[T TaggedInteger]() int {
+	var v T
+	return int(unsafe.Sizeof(v))
+}
+
+// append v to dst little-endian
+func appendTaggedValue[T TaggedInteger](dst []byte, v T) []byte {
+	for i := 0; i < taggedSize[T](); i++ {
+		dst = append(dst, byte(uint64(v)>>(8*i)))
+	}
+	return dst
+}
+
+// get the little-endian value of a tag, def when the tag is missing or has the wrong size
+func GetTaggedValue[T TaggedInteger](t TaggedFields, tag uint16, def T) T {
+	value, ok := t.Get(tag)
+	if !ok || len(value) != taggedSize[T]() {
+		return def
+	}
+	var v uint64
+	for i, b := range value {
+		v |= uint64(b) << (8 * i)
+	}
+	return T(v)
+}
+
+// store v little-endian under a tag
+func SetTaggedValue[T TaggedInteger](p *Payload, tag uint16, v T) {
+	p.SetTagged(tag, appendTaggedValue(make([]byte, 0, taggedSize[T]()), v))
+}
+
+// tagged section for the schema codec, must be the last field of a schema
+type taggedFieldType struct{}
+
+func (taggedFieldType) Type() reflect.Type {
+	return reflect.TypeOf(TaggedFields(nil))
+}
+
+func (taggedFieldType) Encode(e *FieldEncoder, spec FieldSpec, value interface{}) error {
+	tagged, ok := FieldValue[TaggedFields](ByteField{Value: value})
+	if !ok {
+		return fmt.Errorf("%w: expected TaggedFields, got %T", ErrTypeMismatch, value)
+	}
+	encoded, err := tagged.appendBinary(nil)
+	if err != nil {
+		return err
+	}
+	e.buf.Write(encoded)
+	return nil
+}
+
+func (taggedFieldType) Decode(d *FieldDecoder, spec FieldSpec) (interface{}, error) {
+	b, err := d.ReadBytes(uint32(d.Remaining()))
+	if err != nil {
+		return nil, err
+	}
+	tagged, err := readTagged(b, aliasBytes, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &tagged, nil
+}
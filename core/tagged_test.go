@@ -0,0 +1,162 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTaggedFields(t *testing.T) {
+	const (
+		tagKnown   = TagApplication + 1
+		tagUnknown = TagApplication + 2
+	)
+	newPayload := func() *Payload {
+		payload := newTestPayload("Hello, World!", "route", "eu")
+		SetTaggedValue(payload, tagKnown, uint32(7))
+		payload.SetTagged(tagUnknown, []byte("from the future"))
+		return payload
+	}
+
+	t.Run("test set keeps tags ordered", func(t *testing.T) {
+		payload := &Payload{Version: CurrentPayloadVersion}
+		for _, tag := range []uint16{5, 1, 3, 1} {
+			payload.SetTagged(tag, []byte{byte(tag)})
+		}
+		want := TaggedFields{{1, []byte{1}}, {3, []byte{3}}, {5, []byte{5}}}
+		if !reflect.DeepEqual(payload.Tagged, want) {
+			t.Errorf("expected %v, got %v", want, payload.Tagged)
+		}
+		payload.DelTagged(3)
+		payload.DelTagged(4)
+		if _, ok := payload.Tagged.Get(3); ok || len(payload.Tagged) != 2 {
+			t.Errorf("expected tag 3 to be removed, got %v", payload.Tagged)
+		}
+	})
+
+	t.Run("test values and defaults", func(t *testing.T) {
+		payload := newPayload()
+		if got := GetTaggedValue(payload.Tagged, tagKnown, uint32(0)); got != 7 {
+			t.Errorf("expected 7, got %d", got)
+		}
+		if got := GetTaggedValue(payload.Tagged, 1, int64(-1)); got != -1 {
+			t.Errorf("expected the default for a missing tag, got %d", got)
+		}
+		if got := GetTaggedValue(payload.Tagged, tagUnknown, uint32(3)); got != 3 {
+			t.Errorf("expected the default for a value of the wrong size, got %d", got)
+		}
+		type level uint8
+		SetTaggedValue(payload, 1, level(2))
+		if got := GetTaggedValue(payload.Tagged, 1, level(0)); got != 2 {
+			t.Errorf("expected named types to round trip, got %d", got)
+		}
+	})
+
+	t.Run("test round trip", func(t *testing.T) {
+		for _, content := range []ContentType{ContentBinary, ContentJSON, ContentMessagePack} {
+			s := NewSerialisable(WithContentType(content))
+			if err := s.EncodePayload(newPayload()); err != nil {
+				t.Fatalf("%v: encoding failed: %v", content, err)
+			}
+			got, err := s.DecodePayload()
+			if err != nil || !reflect.DeepEqual(got, newPayload()) {
+				t.Errorf("%v: payload mismatch: got %v (%v)", content, got, err)
+			}
+		}
+
+		// the schema codec reads and writes the same section
+		s := NewSerialisable()
+		s.Codec = NewMessageCodec(PayloadSchema)
+		s.Codec.AddFields(newPayload().ToFields())
+		if err := s.Encode(); err != nil {
+			t.Fatalf("schema encoding failed: %v", err)
+		}
+		native, _ := newPayload().MarshalBinary()
+		if !bytes.Equal(s.buf.Bytes(), native) {
+			t.Errorf("schema encoding differs:\ngot  %x\nwant %x", s.buf.Bytes(), native)
+		}
+		fields, err := s.Decode()
+		if err != nil {
+			t.Fatalf("schema decoding failed: %v", err)
+		}
+		var got Payload
+		if err := got.FromFields(fields); err != nil || !reflect.DeepEqual(&got, newPayload()) {
+			t.Errorf("schema decoding mismatch: got %v (%v)", got, err)
+		}
+	})
+
+	t.Run("test older decoders skip the section", func(t *testing.T) {
+		registry := NewCodecRegistry(CurrentPayloadVersion)
+		registry.Register(CurrentPayloadVersion, PayloadSchema[:len(PayloadSchema)-1])
+		s := NewSerialisable(WithCodecRegistry(registry))
+		encoded, _ := newPayload().MarshalBinary()
+		s.InsertDataToSerialisableBuffer(encoded)
+		got, err := s.DecodePayload()
+		if err != nil {
+			t.Fatalf("decoding failed: %v", err)
+		}
+		want := newPayload()
+		want.Tagged = nil
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("payload mismatch: got %v", got)
+		}
+	})
+
+	t.Run("test payloads without the section", func(t *testing.T) {
+		payload := newTestPayload("data")
+		encoded, _ := payload.MarshalBinary()
+		payload.SetTagged(tagKnown, nil)
+		payload.DelTagged(tagKnown)
+		if again, _ := payload.MarshalBinary(); !bytes.Equal(encoded, again) {
+			t.Errorf("an empty section must not change the layout")
+		}
+		var got Payload
+		if err := got.UnmarshalBinary(encoded); err != nil || got.Tagged != nil {
+			t.Fatalf("expected no tagged fields, got %v (%v)", got.Tagged, err)
+		}
+		if v := GetTaggedValue(got.Tagged, tagKnown, uint32(9)); v != 9 {
+			t.Errorf("expected the default, got %d", v)
+		}
+	})
+
+	t.Run("test malformed sections", func(t *testing.T) {
+		encoded, _ := newPayload().MarshalBinary()
+		untagged, _ := (&Payload{Version: CurrentPayloadVersion, ClientId: 42, Identifier: []byte("origin"), Data: []byte("Hello, World!"), Headers: Headers{{"route", "eu"}}}).MarshalBinary()
+		for n := len(untagged) + 1; n < len(encoded); n++ {
+			if n == len(untagged)+taggedEntryOverhead+4 {
+				continue // ends between the two entries
+			}
+			if err := new(Payload).UnmarshalBinary(encoded[:n]); !errors.Is(err, ErrTruncated) {
+				t.Errorf("%d bytes: expected ErrTruncated, got %v", n, err)
+			}
+		}
+
+		entry := func(tag uint16) []byte {
+			return binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint16(nil, tag), 0)
+		}
+		for name, section := range map[string][]byte{
+			"duplicate":    append(entry(3), entry(3)...),
+			"out of order": append(entry(3), entry(1)...),
+		} {
+			if err := new(Payload).UnmarshalBinary(append(untagged, section...)); !errors.Is(err, ErrBadTagged) {
+				t.Errorf("%s: expected ErrBadTagged, got %v", name, err)
+			}
+		}
+
+		unordered := newPayload()
+		unordered.Tagged[0], unordered.Tagged[1] = unordered.Tagged[1], unordered.Tagged[0]
+		for _, content := range []ContentType{ContentBinary, ContentJSON} {
+			if err := NewSerialisable(WithContentType(content)).EncodePayload(unordered); !errors.Is(err, ErrBadTagged) {
+				t.Errorf("%v: expected ErrBadTagged when encoding, got %v", content, err)
+			}
+		}
+
+		v1 := NewPayload(1, 42, nil, nil)
+		v1.SetTagged(1, []byte{1})
+		if err := NewSerialisable().EncodePayload(v1); !errors.Is(err, ErrTaggedUnsupported) {
+			t.Errorf("expected ErrTaggedUnsupported, got %v", err)
+		}
+	})
+}
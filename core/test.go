@@ -21,10 +21,10 @@ func encodeStringToBase64(data []byte) string {
 
 func getPayloadFromSerialisable(req *Serialisable) Payload {
 	gotValues := Payload{
-		*new(uint16),
-		*new(uint16),
-		[]byte{},
-		[]byte{},
+		Version:    *new(uint16),
+		ClientId:   *new(uint16),
+		Identifier: []byte{},
+		Data:       []byte{},
 	}
 
 	decodedFields, err := req.Decode()
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateWire = flag.Bool("update", false, "rewrite the golden wire fixtures in testdata/wire")
+
+// expected decoding of a golden fixture, see docs/wire-format.md
+type wireFixture struct {
+	Description string  `json:"description"`
+	Framed      bool    `json:"framed"`
+	Compression string  `json:"compression"`
+	Content     string  `json:"content"`
+	Key         []byte  `json:"key"`        // AES key of the payload's client
+	DecodeOnly  bool    `json:"decodeOnly"` // encoding is not deterministic
+	Payload     Payload `json:"payload"`
+}
+
+func (f wireFixture) serialisable(t *testing.T) *Serialisable {
+	var opts []SerialisableOpt
+	if f.Framed {
+		opts = append(opts, WithFraming())
+	}
+	if f.Compression != "" {
+		compression, err := ParseCompression(f.Compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts = append(opts, WithCompression(compression, 0))
+	}
+	if f.Content != "" {
+		content, err := ParseContentType(f.Content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts = append(opts, WithContentType(content))
+	}
+	if f.Key != nil {
+		opts = append(opts, WithEncryption(StaticKeys{f.Payload.ClientId: f.Key}))
+	}
+	return NewSerialisable(opts...)
+}
+
+// payloads are equal, treating nil and empty fields alike
+func samePayload(a, b *Payload) bool {
+	if a.Version != b.Version || a.ClientId != b.ClientId || len(a.Headers) != len(b.Headers) {
+		return false
+	}
+	for i := range a.Headers {
+		if a.Headers[i] != b.Headers[i] {
+			return false
+		}
+	}
+	if len(a.Tagged) != len(b.Tagged) {
+		return false
+	}
+	for i := range a.Tagged {
+		if a.Tagged[i].Tag != b.Tagged[i].Tag || !bytes.Equal(a.Tagged[i].Value, b.Tagged[i].Value) {
+			return false
+		}
+	}
+	return bytes.Equal(a.Identifier, b.Identifier) && bytes.Equal(a.Data, b.Data)
+}
+
+// every fixture in testdata/wire must decode to its expected payload and, unless the encoding
+// is not deterministic, encode to the same bytes. Changing the layout fails here; run
+// go test ./core -run TestWireConformance -update after a deliberate change and update the spec.
+func TestWireConformance(t *testing.T) {
+	names, err := filepath.Glob(filepath.Join("testdata", "wire", "*.json"))
+	if err != nil || len(names) == 0 {
+		t.Fatalf("no fixtures found: %v", err)
+	}
+	for _, name := range names {
+		t.Run(strings.TrimSuffix(filepath.Base(name), ".json"), func(t *testing.T) {
+			raw, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fixture wireFixture
+			if err := json.Unmarshal(raw, &fixture); err != nil {
+				t.Fatalf("bad fixture: %v", err)
+			}
+			binName := strings.TrimSuffix(name, ".json") + ".bin"
+
+			want := fixture.Payload
+			if err := DefaultCodecRegistry.Upgrade(&want); err != nil {
+				t.Fatal(err)
+			}
+			decode := func(encoded []byte) (*Payload, error) {
+				s := fixture.serialisable(t)
+				s.InsertDataToSerialisableBuffer(encoded)
+				return s.DecodePayload()
+			}
+
+			s := fixture.serialisable(t)
+			payload := fixture.Payload
+			if err := s.EncodePayload(&payload); err != nil {
+				t.Fatalf("encoding failed: %v", err)
+			}
+			if *updateWire {
+				// decode-only fixtures are kept while they still decode so they do not churn
+				old, err := os.ReadFile(binName)
+				got, decodeErr := decode(old)
+				if !fixture.DecodeOnly || err != nil || decodeErr != nil || !samePayload(got, &want) {
+					if err := os.WriteFile(binName, s.buf.Bytes(), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			golden, err := os.ReadFile(binName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !fixture.DecodeOnly && !bytes.Equal(s.buf.Bytes(), golden) {
+				t.Errorf("encoding changed:\ngot  %x\nwant %x", s.buf.Bytes(), golden)
+			}
+
+			got, err := decode(golden)
+			if err != nil {
+				t.Fatalf("decoding failed: %v", err)
+			}
+			if !samePayload(got, &want) {
+				t.Errorf("decoding mismatch:\ngot  %s\nwant %s", got.MarshalToJson(), want.MarshalToJson())
+			}
+
+			// the schema codec must agree with the native layout
+			if fixture.Compression != "" || fixture.Content != "" || fixture.Key != nil {
+				return
+			}
+			schema := NewSerialisable()
+			schema.framed = fixture.Framed
+			schema.Codec = NewMessageCodec(payloadSchemaFor(fixture.Payload.Version))
+			payload = fixture.Payload
+			schema.Codec.AddFields(payload.ToFields())
+			if err := schema.Encode(); err != nil {
+				t.Fatalf("schema encoding failed: %v", err)
+			}
+			if !bytes.Equal(schema.buf.Bytes(), golden) {
+				t.Errorf("schema encoding differs:\ngot  %x\nwant %x", schema.buf.Bytes(), golden)
+			}
+			fields, err := schema.Decode()
+			if err != nil {
+				t.Fatalf("schema decoding failed: %v", err)
+			}
+			var decoded Payload
+			if err := decoded.FromFields(fields); err != nil || !samePayload(&decoded, &fixture.Payload) {
+				t.Errorf("schema decoding mismatch: got %s (%v)", decoded.MarshalToJson(), err)
+			}
+		})
+	}
+}
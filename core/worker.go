@@ -1,7 +1,10 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 )
 
 var (
@@ -11,9 +14,13 @@ var (
 
 // worker that interacts with the message broker
 type Worker struct {
-	WorkerPool     chan chan *Request // each worker corresponds to a worker pool that holds request channels
-	RequestChannel chan *Request      // worker's request channel
-	quit           chan bool          // signal to quit the worker
+	WorkerPool     chan chan *Request         // each worker corresponds to a worker pool that holds request channels
+	RequestChannel chan *Request              // worker's request channel
+	quit           chan bool                  // signal to quit the worker
+	expire         func(*Request)             // handles expired requests instead of processing them, they are dropped when nil
+	failed         func(*Request, error) bool // takes over requests the processor failed on, true when it did
+	revert         func(*Request)             // undoes the admission of requests that were not processed
+	serial         bool                       // process one request at a time instead of starting a goroutine for each
 }
 
 // creates new worker
@@ -27,6 +34,7 @@ func NewWorker(workerPool chan chan *Request) Worker {
 
 // registers worker's request channel to the pool and waits for requests or quit signal on the request channel.
 func (w Worker) Start(id int, p DataProcessor) {
+	cp := AdaptProcessor(p)
 	go func() {
 		for {
 			// (re)register channel in worker pool (when processing has been performed)
@@ -34,22 +42,12 @@ func (w Worker) Start(id int, p DataProcessor) {
 			select {
 			// receive request in worker channel
 			case req := <-w.RequestChannel:
-				go func(req *Request) {
-					select {
-					case <-req.Ctx.Done():
-						fmt.Printf("Worker %d: Request %d cancelled\n", id, req.Id)
-						return
-					default:
-						fmt.Printf("Worker %d: Processing Request %d\n", id, req.Id)
-
-						if req.Message.buf == nil {
-							fmt.Printf("Worker %d: Request %d has a nil buffer", id, req.Id)
-							return // Skip this request and continue with the next one
-						}
-						// processing implementation
-						p.Process(req)
-					}
-				}(req)
+				if w.serial {
+					// processed before registering again, so at most one request per worker is in progress
+					w.handle(id, cp, req)
+				} else {
+					go w.handle(id, cp, req)
+				}
 
 			case <-w.quit:
 				return
@@ -58,6 +56,69 @@ func (w Worker) Start(id int, p DataProcessor) {
 	}()
 }
 
+// process a request unless it was cancelled or expired, then release it
+func (w Worker) handle(id int, p ContextProcessor, req *Request) {
+	select {
+	case <-req.Ctx.Done():
+		fmt.Printf("Worker %d: Request %d cancelled\n", id, req.Id)
+		w.revertAdmission(req)
+		req.fail(req.Ctx.Err())
+		req.Release()
+		return
+	default:
+		if req.Message.buf == nil {
+			fmt.Printf("Worker %d: Request %d has a nil buffer", id, req.Id)
+			w.revertAdmission(req)
+			req.fail(ErrEmptyBuffer)
+			req.Release()
+			return // Skip this request and continue with the next one
+		}
+		// the request may have expired while waiting for a worker
+		if req.Expired(time.Now()) {
+			fmt.Printf("Worker %d: Request %d expired\n", id, req.Id)
+			w.expired(req)
+			return
+		}
+		// processing implementation, pooled requests go back to their pool once it
+		// returns so processors must not hold on to them
+		ctx, cancel := req.processingContext()
+		err := p.ProcessContext(ctx, req)
+		if errors.Is(err, context.DeadlineExceeded) && errors.Is(context.Cause(ctx), ErrExpired) {
+			err = fmt.Errorf("%w: %w", ErrExpired, err)
+		}
+		cancel()
+		if errors.Is(err, ErrExpired) {
+			fmt.Printf("Worker %d: Request %d expired while processing\n", id, req.Id)
+			w.expired(req)
+			return
+		}
+		if err != nil && w.failed != nil && w.failed(req, err) {
+			return // to be retried or dead-lettered
+		}
+		if err != nil {
+			w.revertAdmission(req)
+		}
+		req.complete(err)
+		req.Release()
+	}
+}
+
+func (w Worker) revertAdmission(req *Request) {
+	if w.revert != nil {
+		w.revert(req)
+	}
+}
+
+// hand an expired request to the dispatcher, or drop it when there is none
+func (w Worker) expired(req *Request) {
+	if w.expire != nil {
+		w.expire(req)
+		return
+	}
+	req.fail(ErrExpired)
+	req.Release()
+}
+
 // Stop signals the worker to stop listening for work requests.
 func (w Worker) Stop() {
 	go func() {
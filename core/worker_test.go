@@ -3,6 +3,7 @@ package core
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -173,4 +174,95 @@ func TestRequestAndQueueHandling(t *testing.T) {
 
 		fmt.Printf("%v", reqStore[1].Message.buf.String())
 	})
+
+	t.Run("test worker takes requests while one is in progress", func(t *testing.T) {
+		started := make(chan int, 2)
+		release := make(chan struct{})
+		defer close(release)
+		queue := make(RequestQueue, 2)
+		dispatcher := NewDispatcher(1, 1)
+		dispatcher.AddQueue(queue)
+		dispatcher.Run(processorFunc(func(req *Request) error {
+			started <- req.Id
+			<-release
+			return nil
+		}))
+
+		queue <- createAndFormatTestRequest(newTestPayload("first"), 1, context.Background())
+		queue <- createAndFormatTestRequest(newTestPayload("second"), 2, context.Background())
+		for i := 0; i < 2; i++ {
+			select {
+			case <-started:
+			case <-time.After(time.Second):
+				t.Fatalf("expected the only worker to process both requests at once, %d started", i)
+			}
+		}
+	})
+}
+
+func TestContextProcessing(t *testing.T) {
+	// processor that runs until it is stopped
+	blocking := ContextProcessorFunc(func(ctx context.Context, req *Request) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	t.Run("test payload deadlines stop processing in progress", func(t *testing.T) {
+		producer := NewProducer(WithoutResultPayloads())
+		sink := make(RequestQueue, 1)
+		dispatcher := NewDispatcher(1, 1)
+		dispatcher.AddQueue(make(RequestQueue, 1))
+		dispatcher.AddExpirySink(sink)
+		dispatcher.Run(blocking)
+		producer.Subscribe(dispatcher)
+		payload := NewPayload(CurrentPayloadVersion, 1, nil, []byte("data"))
+		payload.SetTimestamp(time.Now())
+		payload.SetTTL(20 * time.Millisecond)
+		req, _ := producer.NewRequest(1, payload, context.Background())
+
+		_, err := waitFuture(t, producer.Publish(context.Background(), req))
+		if !errors.Is(err, ErrExpired) {
+			t.Errorf("expected the request to expire while processing, got %v", err)
+		}
+		// handled like requests that expire before they are processed
+		if expired := dispatcher.Stats().Expired; expired != 1 {
+			t.Errorf("expected 1 expired request, got %d", expired)
+		}
+		if len(sink) != 1 {
+			t.Error("expected the request to be sent to the expiry sink")
+		}
+	})
+
+	t.Run("test cancelling the request stops processing in progress", func(t *testing.T) {
+		producer := NewProducer(WithoutResultPayloads())
+		subscribeDispatcher(producer, 1, blocking)
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := producer.NewRequest(1, NewPayload(CurrentPayloadVersion, 1, nil, []byte("data")), ctx)
+
+		future := producer.Publish(context.Background(), req)
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+		if _, err := waitFuture(t, future); !errors.Is(err, context.Canceled) || errors.Is(err, ErrExpired) {
+			t.Errorf("expected the request to be cancelled, got %v", err)
+		}
+	})
+
+	t.Run("test processors without a context are adapted", func(t *testing.T) {
+		called := false
+		p := AdaptProcessor(processorFunc(func(*Request) error {
+			called = true
+			return nil
+		}))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := p.ProcessContext(ctx, &Request{}); !errors.Is(err, context.Canceled) || called {
+			t.Errorf("expected a done context to skip the processor, got %v", err)
+		}
+		if err := p.ProcessContext(context.Background(), &Request{}); err != nil || !called {
+			t.Errorf("expected the processor to be called, got %v", err)
+		}
+		if _, ok := AdaptProcessor(blocking).(ContextProcessorFunc); !ok {
+			t.Error("expected context processors to be used as they are")
+		}
+	})
 }
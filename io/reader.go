@@ -2,6 +2,7 @@ package io
 
 import (
 	"encoding/csv"
+	"gewh/core"
 	"io"
 	"os"
 	"strings"
@@ -10,6 +11,11 @@ import (
 
 var batchIdCounter uint64
 
+// rows per batch read by cmd. EnvelopeRecords costs about 40 bytes per weather row, so a batch
+// of this size stays within the MaxFieldSize of core.DefaultDecodeLimits, even for rows with
+// 100 byte station names.
+const DefaultBatchSize = 100000
+
 // reader interface, can be extended to various formats for different data formats (e.g. json)
 type Reader interface {
 	// using filenames for now can be extended to use ReadWriter instead to extend data sources
@@ -24,10 +30,11 @@ type BatchReader struct {
 	errChan   chan error
 }
 
-// Batch that holds batch id and string of values
+// Batch that holds batch id and string of values, or the records in a batch envelope
 type Batch struct {
-	Id    uint64
-	Value string
+	Id       uint64
+	Value    string
+	Envelope []byte
 }
 
 func NewBatch(value string) *Batch {
@@ -91,3 +98,24 @@ func CombineRecords(records []Record) *Batch {
 	}
 	return NewBatch(strings.Join(combinedRecords, ","))
 }
+
+// Encode records of each batch in a batch envelope, each record is itself an envelope of its
+// fields so values may contain any separator
+func EnvelopeRecords(records []Record) (*Batch, error) {
+	batch := core.NewBatchBuilder()
+	fields := core.NewBatchBuilder()
+	for _, record := range records {
+		fields.Reset()
+		for _, field := range record {
+			if err := fields.Add([]byte(field)); err != nil {
+				return nil, err
+			}
+		}
+		if err := batch.Add(fields.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	envelope := NewBatch("")
+	envelope.Envelope = batch.Bytes()
+	return envelope, nil
+}
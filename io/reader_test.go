@@ -1,7 +1,9 @@
 package io
 
 import (
+	"gewh/core"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -84,3 +86,49 @@ func TestBatchReader(t *testing.T) {
 		})
 	}
 }
+
+func TestEnvelopeRecords(t *testing.T) {
+	records := []Record{{"Helsinki", "15.0"}, {"Washington, D.C.", "21;5"}, {}}
+
+	batch, err := EnvelopeRecords(records)
+	assert.NoError(t, err)
+
+	envelope, err := core.ParseBatch(batch.Envelope)
+	assert.NoError(t, err)
+	assert.Equal(t, len(records), envelope.Len())
+
+	var got []Record
+	it := envelope.Iter()
+	for it.Next() {
+		fields, err := core.ParseBatch(it.Record())
+		assert.NoError(t, err)
+		record := Record{}
+		for f := fields.Iter(); f.Next(); {
+			record = append(record, string(f.Record()))
+		}
+		got = append(got, record)
+	}
+	assert.Equal(t, records, got)
+}
+
+func TestDefaultBatchDecodes(t *testing.T) {
+	// the longest station names a row can have
+	station := strings.Repeat("x", 100)
+	records := make([]Record, DefaultBatchSize)
+	for i := range records {
+		records[i] = Record{station, "-99.9"}
+	}
+	batch, err := EnvelopeRecords(records)
+	assert.NoError(t, err)
+
+	payload := core.NewPayload(core.CurrentPayloadVersion, 1, []byte("batch-1"), batch.Envelope)
+	payload.SetHeader("content-type", core.BatchContentType)
+	msg := core.NewSerialisable()
+	assert.NoError(t, msg.EncodePayload(payload))
+
+	decoded, err := msg.DecodePayload()
+	assert.NoError(t, err)
+	envelope, err := decoded.Batch()
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultBatchSize, envelope.Len())
+}
@@ -30,6 +30,10 @@ func wordCountMapFunc(payload *core.Payload) []KeyValue {
 }
 
 func WeatherMapFunc(payload *core.Payload) []KeyValue {
+	if contentType, _ := payload.Headers.Get("content-type"); contentType == core.BatchContentType {
+		return weatherBatchMapFunc(payload)
+	}
+
 	pairs := strings.Split(string(payload.Data), ",")
 
 	kvs := make([]KeyValue, len(pairs))
@@ -44,3 +48,28 @@ func WeatherMapFunc(payload *core.Payload) []KeyValue {
 
 	return kvs
 }
+
+// records of a batch envelope, each an envelope of station and temperature fields
+func weatherBatchMapFunc(payload *core.Payload) []KeyValue {
+	batch, err := payload.Batch()
+	if err != nil {
+		return nil
+	}
+
+	kvs := make([]KeyValue, 0, batch.Len())
+
+	for it := batch.Iter(); it.Next(); {
+		fields, err := core.ParseBatch(it.Record())
+		if err != nil || fields.Len() < 2 {
+			continue
+		}
+		station, _ := fields.Record(0)
+		temperature, _ := fields.Record(1)
+		kvs = append(kvs, KeyValue{
+			Key:   string(station),
+			Value: temperature,
+		})
+	}
+
+	return kvs
+}
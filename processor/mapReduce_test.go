@@ -54,6 +54,38 @@ func TestMapFunction(t *testing.T) {
 
 		assert.Equal(t, expected, actual)
 	})
+
+	t.Run("Test with weather data in a batch envelope", func(t *testing.T) {
+		batch := core.NewBatchBuilder()
+		for _, row := range [][]string{{"Helsinski", "15.0"}, {"Washington, D.C.", "16.2"}, {"Lisbon;Portugal", "12.1"}} {
+			fields := core.NewBatchBuilder()
+			for _, field := range row {
+				fields.Add([]byte(field))
+			}
+			batch.Add(fields.Bytes())
+		}
+		payload := core.NewPayload(core.CurrentPayloadVersion, 1, []byte("token"), batch.Bytes())
+		payload.SetHeader("content-type", core.BatchContentType)
+
+		expected := []KeyValue{
+			{
+				Key:   "Helsinski",
+				Value: []byte("15.0"),
+			},
+			{
+				Key:   "Washington, D.C.",
+				Value: []byte("16.2"),
+			},
+			{
+				Key:   "Lisbon;Portugal",
+				Value: []byte("12.1"),
+			},
+		}
+
+		actual := WeatherMapFunc(payload)
+
+		assert.Equal(t, expected, actual)
+	})
 }
 
 func TestReduceFunction(t *testing.T) {
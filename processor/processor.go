@@ -1,8 +1,10 @@
 package processor
 
 import (
+	"context"
 	"gewh/core"
 	"log"
+	"runtime"
 	"sync"
 )
 
@@ -30,35 +32,34 @@ func NewProcessor(mapFunc MapFunc, reduceFunc ReduceFunc) *Processor {
 	}
 }
 
-// adapter for process interface in core for request processing
+// adapter for process interface in core for request processing, returns once the request is
+// processed so workers can report its error and release it. Wait blocks while requests are in progress.
 func (p *Processor) Process(req *core.Request) error {
-	p.Add(1)
-	var err error
-
-	go func(req *core.Request) {
-		defer p.Done()
-		err = ProcessRawData(req, p.mapFunc, p.reduceFunc)
-	}(req)
-
-	if err != nil {
-		return err
+	ctx := req.Ctx
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	return nil
+	return p.ProcessContext(ctx, req)
+}
+
+// process the request until ctx is done, implements core.ContextProcessor
+func (p *Processor) ProcessContext(ctx context.Context, req *core.Request) error {
+	p.Add(1)
+	defer p.Done()
+	return ProcessRawData(ctx, req, p.mapFunc, p.reduceFunc)
 }
 
-// processing raw incoming requests
-func ProcessRawData(req *core.Request, mapFunc MapFunc, reduceFunc ReduceFunc) error {
+// processing raw incoming requests, nothing is stored when ctx is done before they are processed
+func ProcessRawData(ctx context.Context, req *core.Request, mapFunc MapFunc, reduceFunc ReduceFunc) error {
 	// Steps 1-2: Decode the message and extract payload (unchanged)
-	fields, err := req.Message.Decode()
+	payload, err := req.Message.DecodePayload()
 	if err != nil {
 		log.Printf("Could not decode data on request: %v, error: %v", req.Id, err)
 		return err
 	}
-	var payload core.Payload
-	payload.FromFields(fields)
 
 	// Step 3: Map operation
-	batchResults, err := mapReduceOptimized(&payload, mapFunc, reduceFunc)
+	batchResults, err := mapReduceOptimized(ctx, payload, mapFunc, reduceFunc)
 	if err != nil {
 		return err
 	}
@@ -69,10 +70,14 @@ func ProcessRawData(req *core.Request, mapFunc MapFunc, reduceFunc ReduceFunc) e
 	return nil
 }
 
-// group map and reduce so they are done in one operation
-func mapReduceOptimized(data *core.Payload, mapFunc MapFunc, reduceFunc ReduceFunc) ([]KeyValue, error) {
+// group map and reduce so they are done in one operation. Groups are reduced concurrently by at
+// most GOMAXPROCS goroutines, which stop picking up groups once ctx is done or a group fails.
+func mapReduceOptimized(ctx context.Context, data *core.Payload, mapFunc MapFunc, reduceFunc ReduceFunc) ([]KeyValue, error) {
 	// Perform mapping
 	kvs := mapFunc(data)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	// Group by key and reduce concurrently
 	groups := make(map[string][][]byte)
@@ -80,44 +85,57 @@ func mapReduceOptimized(data *core.Payload, mapFunc MapFunc, reduceFunc ReduceFu
 		groups[kv.Key] = append(groups[kv.Key], kv.Value)
 	}
 
+	reduceCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	keys := make(chan string, len(groups))
+	for key := range groups {
+		keys <- key
+	}
+	close(keys)
+
 	results := make([]KeyValue, 0, len(groups))
+	var mu sync.Mutex
 	var wg sync.WaitGroup
-	resultChan := make(chan KeyValue, len(groups))
-	errChan := make(chan error, 1)
-
-	for key, values := range groups {
+	for i := min(runtime.GOMAXPROCS(0), len(groups)); i > 0; i-- {
 		wg.Add(1)
-		go func(k string, v [][]byte) {
+		go func() {
 			defer wg.Done()
-			reduced, err := reduceFunc(v)
-			if err != nil {
-				select {
-				case errChan <- err:
-				default:
+			for key := range keys {
+				if reduceCtx.Err() != nil {
+					return
 				}
-				return
+				reduced, err := reduceFunc(groups[key])
+				if err != nil {
+					// the first error is the cause, the rest are dropped
+					cancel(err)
+					return
+				}
+				mu.Lock()
+				results = append(results, KeyValue{Key: key, Value: reduced})
+				mu.Unlock()
 			}
-			resultChan <- KeyValue{Key: k, Value: reduced}
-		}(key, values)
+		}()
 	}
 
+	done := make(chan struct{})
 	go func() {
 		wg.Wait()
-		close(resultChan)
-		close(errChan)
+		close(done)
 	}()
 
-	for {
-		select {
-		case result, ok := <-resultChan:
-			if !ok {
-				return results, nil
-			}
-			results = append(results, result)
-		case err := <-errChan:
-			return nil, err
-		}
+	select {
+	case <-done:
+	case <-reduceCtx.Done():
+		// groups being reduced are left to finish in the background, their results are dropped
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if reduceCtx.Err() != nil {
+		return nil, context.Cause(reduceCtx)
 	}
+	return results, nil
 }
 
 // aggreagating into records
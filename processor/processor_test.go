@@ -2,8 +2,10 @@ package processor
 
 import (
 	"context"
+	"errors"
 	"gewh/core"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -58,3 +60,67 @@ func TestProcess(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessReturnsErrors(t *testing.T) {
+	p := NewProcessor(WeatherMapFunc, WeatherReduce())
+	msg := core.NewSerialisable()
+	msg.InsertDataToSerialisableBuffer([]byte{0x02})
+	req := core.NewRequest(1, msg, context.Background())
+
+	// the error is returned by Process itself, not lost in a goroutine
+	assert.ErrorIs(t, p.Process(req), core.ErrTruncated)
+}
+
+func TestProcessContext(t *testing.T) {
+	newRequest := func(id int) *core.Request {
+		req := core.NewRequest(id, core.NewSerialisable(), context.Background())
+		req.AddPayload(core.NewPayload(uint16(1), uint16(1), []byte("origin"), []byte("Helsinki;15.0,London;16.2")))
+		return req
+	}
+	stored := func(id int) bool {
+		_, ok := batchResults.Load(id)
+		return ok
+	}
+
+	t.Run("test cancelled requests are not processed", func(t *testing.T) {
+		p := NewProcessor(WeatherMapFunc, WeatherReduce())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, p.ProcessContext(ctx, newRequest(101)), context.Canceled)
+		assert.False(t, stored(101))
+	})
+
+	t.Run("test deadlines stop reduce in progress", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		blocking := func([][]byte) ([]byte, error) {
+			<-release
+			return nil, nil
+		}
+		p := NewProcessor(WeatherMapFunc, blocking)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		assert.ErrorIs(t, p.ProcessContext(ctx, newRequest(102)), context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.False(t, stored(102))
+	})
+
+	t.Run("test reduce errors are returned", func(t *testing.T) {
+		failure := errors.New("reduce failed")
+		p := NewProcessor(WeatherMapFunc, func([][]byte) ([]byte, error) { return nil, failure })
+		assert.ErrorIs(t, p.ProcessContext(context.Background(), newRequest(103)), failure)
+		assert.False(t, stored(103))
+	})
+
+	t.Run("test process uses the request context", func(t *testing.T) {
+		p := NewProcessor(WeatherMapFunc, WeatherReduce())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req := newRequest(104)
+		req.Ctx = ctx
+		assert.ErrorIs(t, p.Process(req), context.Canceled)
+		assert.False(t, stored(104))
+	})
+}